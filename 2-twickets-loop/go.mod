@@ -1,5 +0,0 @@
-module github.com/ethanhosier/2-twickets-loop
-
-go 1.23.2
-
-require github.com/joho/godotenv v1.5.1
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// signatureLength is how many bytes of the MAC go in a link.
+	signatureLength = 16
+	defaultSnooze   = 6 * time.Hour
+)
+
+var (
+	ackSecret  []byte
+	ackBaseUrl string
+)
+
+var listingPage = template.Must(template.New("listing").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Source}} listing {{.ID}}</title>
+</head>
+<body>
+<h1>{{.Source}} listing {{.ID}}</h1>
+{{with .State}}{{if .Ticket.ID}}<p>{{ticketPrice .Ticket}} in section {{.Ticket.Section}}, row {{.Ticket.Row}}. <a href="{{.Ticket.Link}}">Open listing</a></p>{{end}}{{end}}
+{{if .Done}}<p><strong>{{.Done}}</strong></p>{{end}}
+<form method="post">
+<button name="action" value="ack">Ack (no more reminders)</button>
+</form>
+<form method="post">
+<input type="hidden" name="action" value="snooze">
+<select name="for">
+<option value="1h">1 hour</option>
+<option value="6h" selected>6 hours</option>
+<option value="24h">24 hours</option>
+<option value="72h">3 days</option>
+</select>
+<button>Snooze</button>
+</form>
+<form method="post">
+<button name="action" value="blacklist">Blacklist (never show again)</button>
+</form>
+</body>
+</html>
+`))
+
+type listingPageData struct {
+	Source string
+	ID     string
+	State  *listingState
+	Done   string
+}
+
+func loadAckConfig(addr string) error {
+	secret := os.Getenv("ACK_SECRET")
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("generating ACK_SECRET: %w", err)
+		}
+		secret = hex.EncodeToString(b)
+		slog.Warn("ACK_SECRET not set, alert links will stop working on restart")
+	}
+	ackSecret = []byte(secret)
+
+	ackBaseUrl = os.Getenv("ACK_BASE_URL")
+	if ackBaseUrl == "" {
+		ackBaseUrl = "http://localhost" + addr
+	}
+
+	return nil
+}
+
+func signListing(source, id string) string {
+	mac := hmac.New(sha256.New, ackSecret)
+	mac.Write([]byte(source + ":" + id))
+
+	return hex.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
+
+func ackLink(ticket Ticket) string {
+	return fmt.Sprintf("%s/l/%s/%s?s=%s", ackBaseUrl, url.PathEscape(ticket.Source), url.PathEscape(ticket.ID), signListing(ticket.Source, ticket.ID))
+}
+
+func verifyListing(r *http.Request) (string, string, bool) {
+	source := r.PathValue("source")
+	id := r.PathValue("id")
+
+	ok := hmac.Equal([]byte(r.URL.Query().Get("s")), []byte(signListing(source, id)))
+
+	return source, id, ok
+}
+
+func renderListingPage(w http.ResponseWriter, source, id, done string) {
+	data := listingPageData{
+		Source: source,
+		ID:     id,
+		Done:   done,
+	}
+
+	if state, ok := store.get(source + ":" + id); ok {
+		data.State = &state
+	}
+
+	if err := listingPage.Execute(w, data); err != nil {
+		slog.Error("Error rendering listing page", "error", err)
+	}
+}
+
+// handleListingPage only renders the actions. Link previews in messaging apps
+// fetch URLs on their own, so nothing changes until a form is posted.
+func handleListingPage(w http.ResponseWriter, r *http.Request) {
+	source, id, ok := verifyListing(r)
+	if !ok {
+		http.Error(w, "invalid link", http.StatusForbidden)
+		return
+	}
+
+	renderListingPage(w, source, id, "")
+}
+
+func handleListingAction(w http.ResponseWriter, r *http.Request) {
+	source, id, ok := verifyListing(r)
+	if !ok {
+		http.Error(w, "invalid link", http.StatusForbidden)
+		return
+	}
+
+	key := source + ":" + id
+
+	var done string
+	switch r.FormValue("action") {
+	case "ack":
+		store.ack(key)
+		done = "Acked, you won't be reminded about this listing again."
+	case "snooze":
+		d, err := time.ParseDuration(r.FormValue("for"))
+		if err != nil || d <= 0 {
+			d = defaultSnooze
+		}
+		until := time.Now().Add(d)
+		store.snooze(key, until)
+		done = fmt.Sprintf("Snoozed until %s.", until.Format("Mon 15:04"))
+	case "blacklist":
+		store.blacklist(key)
+		done = "Blacklisted, this listing will be ignored."
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	slog.Info("Listing actioned", "source", source, "listing", id, "action", r.FormValue("action"))
+	renderListingPage(w, source, id, done)
+}
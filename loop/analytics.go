@@ -0,0 +1,397 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	defaultStatsInterval = time.Hour
+	maxStatsPoints       = 5000
+)
+
+// StatsPoint summarises the asking prices of the listings up at the end of
+// one interval.
+type StatsPoint struct {
+	At             time.Time `json:"at"`
+	HoursToKickoff *float64  `json:"hoursToKickoff,omitempty"`
+	Listings       int       `json:"listings"`
+	Min            float64   `json:"min"`
+	P10            float64   `json:"p10"`
+	Median         float64   `json:"median"`
+}
+
+// RealisedPoint summarises the prices listings sold at in one interval.
+type RealisedPoint struct {
+	At             time.Time `json:"at"`
+	HoursToKickoff *float64  `json:"hoursToKickoff,omitempty"`
+	Sales          int       `json:"sales"`
+	Min            float64   `json:"min"`
+	Median         float64   `json:"median"`
+}
+
+// MarketStats is a price series for an event, fixture or section. Listings in
+// different currencies get separate series.
+type MarketStats struct {
+	Section  string       `json:"section,omitempty"`
+	Currency string       `json:"currency"`
+	Points   []StatsPoint `json:"points"`
+	// Gone counts listings that disappeared, bought or withdrawn, and
+	// MedianHoursOnMarket is how long they were up for.
+	Gone                int     `json:"gone"`
+	MedianHoursOnMarket float64 `json:"medianHoursOnMarket"`
+	// Realised is the series of inferred sale prices, for intervals with
+	// any sales.
+	Realised []RealisedPoint `json:"realised"`
+}
+
+type statsQuery struct {
+	Fixture   string
+	Source    string
+	EventID   string
+	Section   string
+	BySection bool
+	Since     time.Time
+	Until     time.Time
+	Interval  time.Duration
+}
+
+// snapshot is every listing one source had for an event at one poll.
+type snapshot struct {
+	at      time.Time
+	feed    [2]string
+	tickets []Ticket
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// getSnapshots regroups stored observations into the snapshots they were
+// written as, including the empty ones of polls that found no listings.
+func getSnapshots(filter observationFilter) ([]snapshot, error) {
+	filter.Empty = true
+	observations, err := getObservations(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]snapshot, 0)
+	index := make(map[[2]string]int)
+	for _, o := range observations {
+		feed := [2]string{o.Ticket.Source, o.Ticket.EventID}
+		i, ok := index[feed]
+		if !ok || !snapshots[i].at.Equal(o.ObservedAt) {
+			i = len(snapshots)
+			index[feed] = i
+			snapshots = append(snapshots, snapshot{at: o.ObservedAt, feed: feed, tickets: []Ticket{}})
+		}
+
+		if o.Ticket.ID != "" {
+			snapshots[i].tickets = append(snapshots[i].tickets, o.Ticket)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// snapshotsFrom is where a replay of the snapshots must start to know every
+// feed's listings at since: the oldest of the feeds' last snapshots taken
+// by then. It's since itself when no feed has one.
+func snapshotsFrom(filter observationFilter, since time.Time) (time.Time, error) {
+	filter.Since, filter.Until = time.Time{}, since.Add(time.Second)
+	condition, args := filterCondition(filter, "observed_at")
+
+	var from sql.NullInt64
+	err := db.QueryRow(`SELECT MIN(last) FROM (SELECT MAX(observed_at) AS last FROM observations WHERE `+condition+` GROUP BY source, event_id)`, args...).Scan(&from)
+	if err != nil || !from.Valid {
+		return since, err
+	}
+
+	return time.Unix(from.Int64, 0), nil
+}
+
+// kickoffFor finds the kickoff of the fixture a query is about, if known.
+func kickoffFor(q statsQuery) *time.Time {
+	fixtureID := q.Fixture
+	if fixtureID == "" && q.Source != "" && q.EventID != "" {
+		fixtureID, _ = fixtures.fixtureOf(marketplaceOf(q.Source), q.EventID)
+	}
+
+	if f, ok := fixtures.get(fixtureID); ok {
+		return f.Kickoff
+	}
+	return nil
+}
+
+// marketStats replays the stored snapshots interval by interval. A snapshot
+// holds until the next one from the same source, so quiet intervals carry
+// the last known listings forward. With a start time, the replay begins at
+// the snapshots in force then, so listings up since before them count as
+// first seen there.
+func marketStats(q statsQuery) ([]MarketStats, error) {
+	if q.Interval <= 0 {
+		q.Interval = defaultStatsInterval
+	}
+
+	filter := observationFilter{
+		Source:  q.Source,
+		EventID: q.EventID,
+		Fixture: q.Fixture,
+		Until:   q.Until,
+	}
+	if !q.Since.IsZero() {
+		from, err := snapshotsFrom(filter, q.Since.Truncate(q.Interval))
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = from
+	}
+
+	snapshots, err := getSnapshots(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[[2]string]*MarketStats)
+	seriesOf := func(t Ticket) ([2]string, bool) {
+		area := normaliseArea(t.Section)
+		if q.Section != "" && area != normaliseArea(q.Section) {
+			return [2]string{}, false
+		}
+		if !q.BySection && q.Section == "" {
+			area = ""
+		}
+
+		key := [2]string{area, currencyOf(t)}
+		if series[key] == nil {
+			series[key] = &MarketStats{Section: area, Currency: key[1], Points: []StatsPoint{}, Realised: []RealisedPoint{}}
+		}
+		return key, true
+	}
+
+	onMarket := make(map[[2]string][]float64)
+	firstSeen := make(map[string]time.Time)
+	current := make(map[[2]string][]Ticket)
+	apply := func(s snapshot) {
+		present := make(map[string]bool, len(s.tickets))
+		for _, t := range s.tickets {
+			present[t.Key()] = true
+			if _, ok := firstSeen[t.Key()]; !ok {
+				firstSeen[t.Key()] = s.at
+			}
+		}
+
+		for _, t := range current[s.feed] {
+			if present[t.Key()] {
+				continue
+			}
+			if key, ok := seriesOf(t); ok && !s.at.Before(q.Since) {
+				onMarket[key] = append(onMarket[key], s.at.Sub(firstSeen[t.Key()]).Hours())
+			}
+			delete(firstSeen, t.Key())
+		}
+
+		current[s.feed] = s.tickets
+	}
+
+	if len(snapshots) == 0 {
+		return []MarketStats{}, nil
+	}
+
+	since := q.Since
+	if since.IsZero() {
+		since = snapshots[0].at
+	}
+	since = since.Truncate(q.Interval)
+
+	until := q.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	if until.Sub(since)/q.Interval > maxStatsPoints {
+		return nil, fmt.Errorf("more than %d intervals, use a longer interval or a shorter range", maxStatsPoints)
+	}
+
+	kickoff := kickoffFor(q)
+
+	next := 0
+	for end := since.Add(q.Interval); end.Before(until.Add(q.Interval)); end = end.Add(q.Interval) {
+		for next < len(snapshots) && snapshots[next].at.Before(end) {
+			apply(snapshots[next])
+			next++
+		}
+
+		prices := make(map[[2]string][]float64)
+		for _, tickets := range current {
+			for _, t := range tickets {
+				if key, ok := seriesOf(t); ok {
+					prices[key] = append(prices[key], t.Price)
+				}
+			}
+		}
+
+		for key, p := range prices {
+			sort.Float64s(p)
+
+			point := StatsPoint{
+				At:       end,
+				Listings: len(p),
+				Min:      p[0],
+				P10:      percentile(p, 0.1),
+				Median:   percentile(p, 0.5),
+			}
+			if kickoff != nil {
+				hours := kickoff.Sub(end).Hours()
+				point.HoursToKickoff = &hours
+			}
+
+			series[key].Points = append(series[key].Points, point)
+		}
+	}
+
+	sales, err := getSales(observationFilter{
+		Source:  q.Source,
+		EventID: q.EventID,
+		Fixture: q.Fixture,
+		Since:   since,
+		Until:   until,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	realised := make(map[[2]string]map[time.Time][]float64)
+	for _, sale := range sales {
+		key, ok := seriesOf(sale.Ticket)
+		if !ok {
+			continue
+		}
+		if realised[key] == nil {
+			realised[key] = make(map[time.Time][]float64)
+		}
+
+		end := sale.SoldAt.Truncate(q.Interval).Add(q.Interval)
+		realised[key][end] = append(realised[key][end], sale.Ticket.Price)
+	}
+
+	for key, intervals := range realised {
+		for end, p := range intervals {
+			sort.Float64s(p)
+
+			point := RealisedPoint{
+				At:     end,
+				Sales:  len(p),
+				Min:    p[0],
+				Median: percentile(p, 0.5),
+			}
+			if kickoff != nil {
+				hours := kickoff.Sub(end).Hours()
+				point.HoursToKickoff = &hours
+			}
+
+			series[key].Realised = append(series[key].Realised, point)
+		}
+
+		sort.Slice(series[key].Realised, func(i, j int) bool {
+			return series[key].Realised[i].At.Before(series[key].Realised[j].At)
+		})
+	}
+
+	stats := make([]MarketStats, 0, len(series))
+	for key, s := range series {
+		hours := onMarket[key]
+		sort.Float64s(hours)
+		s.Gone = len(hours)
+		s.MedianHoursOnMarket = percentile(hours, 0.5)
+
+		if len(s.Points) > 0 || s.Gone > 0 || len(s.Realised) > 0 {
+			stats = append(stats, *s)
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Section != stats[j].Section {
+			return stats[i].Section < stats[j].Section
+		}
+		return stats[i].Currency < stats[j].Currency
+	})
+
+	return stats, nil
+}
+
+// runStats prints market statistics as tab separated rows, one per series
+// and interval.
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	fixture := flags.String("fixture", "", "fixture to summarise, across every marketplace")
+	source := flags.String("source", "", "source to summarise")
+	event := flags.String("event", "", "marketplace event ID to summarise")
+	section := flags.String("section", "", "only this section")
+	bySection := flags.Bool("by-section", false, "one series per section")
+	interval := flags.Duration("interval", defaultStatsInterval, "length of each interval")
+	from := flags.String("from", "", "start of the range (RFC3339)")
+	to := flags.String("to", "", "end of the range (RFC3339), defaults to now")
+	realised := flags.Bool("realised", false, "print the prices listings sold at instead of asking prices")
+	flags.Parse(args)
+
+	q := statsQuery{
+		Fixture:   *fixture,
+		Source:    *source,
+		EventID:   *event,
+		Section:   *section,
+		BySection: *bySection,
+		Interval:  *interval,
+	}
+
+	var err error
+	if q.Since, err = parseTime(*from); err != nil {
+		fatal("Invalid -from", "error", err)
+	}
+	if q.Until, err = parseTime(*to); err != nil {
+		fatal("Invalid -to", "error", err)
+	}
+
+	stats, err := marketStats(q)
+	if err != nil {
+		fatal("Error computing stats", "error", err)
+	}
+
+	if *realised {
+		fmt.Println("section\tcurrency\tat\thours_to_kickoff\tsales\tmin\tmedian")
+		for _, s := range stats {
+			for _, p := range s.Realised {
+				fmt.Printf("%s\t%s\t%s\t%s\t%d\t%.2f\t%.2f\n", s.Section, s.Currency, p.At.Format(time.RFC3339), formatHours(p.HoursToKickoff), p.Sales, p.Min, p.Median)
+			}
+		}
+		return
+	}
+
+	fmt.Println("section\tcurrency\tat\thours_to_kickoff\tlistings\tmin\tp10\tmedian")
+	for _, s := range stats {
+		for _, p := range s.Points {
+			fmt.Printf("%s\t%s\t%s\t%s\t%d\t%.2f\t%.2f\t%.2f\n", s.Section, s.Currency, p.At.Format(time.RFC3339), formatHours(p.HoursToKickoff), p.Listings, p.Min, p.P10, p.Median)
+		}
+	}
+
+	for _, s := range stats {
+		fmt.Fprintf(os.Stderr, "Section %q (%s): %d listings gone, median %.1fh on the market.\n", s.Section, s.Currency, s.Gone, s.MedianHoursOnMarket)
+	}
+}
+
+func formatHours(hours *float64) string {
+	if hours == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", *hours)
+}
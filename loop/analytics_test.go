@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func listingsAt(stats []MarketStats, at time.Time) int {
+	for _, s := range stats {
+		for _, p := range s.Points {
+			if p.At.Equal(at) {
+				return p.Listings
+			}
+		}
+	}
+	return 0
+}
+
+// TestMarketStatsEmptySnapshot checks a poll that found nothing ends the
+// previous listings, and that a range starting later still picks up the
+// listings in force when it starts.
+func TestMarketStatsEmptySnapshot(t *testing.T) {
+	if err := openDB(filepath.Join(t.TempDir(), "watcher.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	listed := []Ticket{
+		{Source: "viagogo", EventID: "1", ID: "a", Section: "112", Price: 90},
+		{Source: "viagogo", EventID: "1", ID: "b", Section: "112", Price: 110},
+	}
+
+	if err := recordSnapshot(listed, nil, start); err != nil {
+		t.Fatal(err)
+	}
+	changes := diffListings(listed, []Ticket{}, start.Add(5*time.Hour))
+	if err := recordSnapshot([]Ticket{}, emptiedFeeds(changes, []Ticket{}), start.Add(5*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	q := statsQuery{Source: "viagogo", EventID: "1", Interval: time.Hour, Until: start.Add(8 * time.Hour)}
+	stats, err := marketStats(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listingsAt(stats, start.Add(3*time.Hour)); got != 2 {
+		t.Errorf("got %d listings before the empty poll, want 2", got)
+	}
+	if got := listingsAt(stats, start.Add(7*time.Hour)); got != 0 {
+		t.Errorf("got %d listings after the empty poll, want 0", got)
+	}
+
+	q.Since = start.Add(2 * time.Hour)
+	stats, err = marketStats(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listingsAt(stats, start.Add(3*time.Hour)); got != 2 {
+		t.Errorf("got %d listings in a range starting after the snapshot, want 2", got)
+	}
+
+	from, err := snapshotsFrom(observationFilter{Source: "viagogo", EventID: "1"}, start.Add(6*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(start.Add(5 * time.Hour)) {
+		t.Errorf("replay starts at %s, want the empty poll at %s", from, start.Add(5*time.Hour))
+	}
+
+	// The empty poll's row isn't a listing.
+	observations, err := getObservations(observationFilter{Source: "viagogo", EventID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 2 {
+		t.Errorf("got %d observations, want 2", len(observations))
+	}
+}
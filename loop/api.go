@@ -0,0 +1,602 @@
+package main
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 1000
+)
+
+var (
+	errWatchNotFound = errors.New("watch not found")
+)
+
+type EventSummary struct {
+	Source   string   `json:"source"`
+	EventID  string   `json:"eventId"`
+	Watches  []string `json:"watches"`
+	Listings int      `json:"listings"`
+	Cheapest *Ticket  `json:"cheapest,omitempty"`
+}
+
+type FixtureSummary struct {
+	Fixture
+	Events []EventLink `json:"events"`
+}
+
+type Subscription struct {
+	Watch       string `json:"watch"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+func registerApi(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/events", handleApiEvents)
+	mux.HandleFunc("GET /api/v1/listings", handleApiListings)
+	mux.HandleFunc("GET /api/v1/areas", handleApiAreas)
+	mux.HandleFunc("GET /api/v1/duplicates", handleApiDuplicates)
+	mux.HandleFunc("GET /api/v1/history", handleApiHistory)
+	mux.HandleFunc("GET /api/v1/sales", handleApiSales)
+	mux.HandleFunc("GET /api/v1/stats", handleApiStats)
+	mux.HandleFunc("GET /api/v1/alerts", requireToken(handleApiAlerts))
+	mux.HandleFunc("GET /api/v1/polls", handleApiPolls)
+	mux.HandleFunc("GET /api/v1/stream", handleApiStream)
+
+	mux.HandleFunc("GET /api/v1/watches", requireToken(handleApiWatches))
+	mux.HandleFunc("GET /api/v1/watches/{id}", requireToken(handleApiWatch))
+	mux.HandleFunc("GET /api/v1/watches/{id}/forecast", handleApiForecast)
+	mux.HandleFunc("POST /api/v1/watches", requireToken(handleApiAddWatch))
+	mux.HandleFunc("PATCH /api/v1/watches/{id}", requireToken(handleApiUpdateWatch))
+	mux.HandleFunc("DELETE /api/v1/watches/{id}", requireToken(handleApiRemoveWatch))
+
+	mux.HandleFunc("GET /api/v1/fixtures", handleApiFixtures)
+	mux.HandleFunc("POST /api/v1/fixtures", requireToken(handleApiAddFixture))
+	mux.HandleFunc("PUT /api/v1/fixtures/{id}/events/{marketplace}/{eventId}", requireToken(handleApiLinkEvent))
+
+	mux.HandleFunc("GET /api/v1/subscriptions", requireToken(handleApiSubscriptions))
+	mux.HandleFunc("POST /api/v1/watches/{id}/subscriptions", requireToken(handleApiSubscribe))
+	mux.HandleFunc("DELETE /api/v1/watches/{id}/subscriptions/{phoneNumber}", requireToken(handleApiUnsubscribe))
+}
+
+// requireToken guards the endpoints that change what we watch or show phone
+// numbers. Without API_TOKEN set they're refused rather than left open.
+func requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("API_TOKEN")
+		if token == "" {
+			writeError(w, http.StatusForbidden, errors.New("API_TOKEN isn't set, so this endpoint is disabled"))
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid API token"))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Error writing response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseLimit(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", value)
+	}
+
+	return limit, nil
+}
+
+func handleApiEvents(w http.ResponseWriter, r *http.Request) {
+	listings := watcher.getListings()
+	events := make(map[[2]string]*EventSummary)
+
+	for _, wt := range registry.list() {
+		key := [2]string{wt.Source, wt.EventID}
+		event, ok := events[key]
+		if !ok {
+			event = &EventSummary{Source: wt.Source, EventID: wt.EventID, Watches: []string{}}
+			events[key] = event
+		}
+		event.Watches = append(event.Watches, wt.ID)
+
+		for _, t := range listings[wt.ID] {
+			event.Listings++
+			if event.Cheapest == nil || t.Price < event.Cheapest.Price {
+				cheapest := t
+				event.Cheapest = &cheapest
+			}
+		}
+	}
+
+	summaries := make([]EventSummary, 0, len(events))
+	for _, event := range events {
+		summaries = append(summaries, *event)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Source != summaries[j].Source {
+			return summaries[i].Source < summaries[j].Source
+		}
+		return summaries[i].EventID < summaries[j].EventID
+	})
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func handleApiListings(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	eventID := r.URL.Query().Get("event")
+
+	tickets := make([]Ticket, 0)
+	for _, watchTickets := range watcher.getListings() {
+		for _, t := range watchTickets {
+			if source != "" && t.Source != source {
+				continue
+			}
+
+			if eventID != "" && t.EventID != eventID {
+				continue
+			}
+
+			tickets = append(tickets, t)
+		}
+	}
+
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].Price < tickets[j].Price
+	})
+
+	writeJSON(w, http.StatusOK, tickets)
+}
+
+func handleApiAreas(w http.ResponseWriter, r *http.Request) {
+	fixture := r.URL.Query().Get("fixture")
+
+	areas := make([]AreaOffer, 0)
+	for f, tickets := range fixtureListings() {
+		if fixture != "" && f != fixture {
+			continue
+		}
+		areas = append(areas, bestByArea(f, tickets)...)
+	}
+
+	sort.SliceStable(areas, func(i, j int) bool {
+		return areas[i].Fixture < areas[j].Fixture
+	})
+
+	writeJSON(w, http.StatusOK, areas)
+}
+
+func handleApiDuplicates(w http.ResponseWriter, r *http.Request) {
+	fixture := r.URL.Query().Get("fixture")
+
+	duplicates := make([]DuplicateListing, 0)
+	for f, tickets := range fixtureListings() {
+		if fixture != "" && f != fixture {
+			continue
+		}
+		duplicates = append(duplicates, findDuplicates(f, tickets)...)
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Fixture < duplicates[j].Fixture
+	})
+
+	writeJSON(w, http.StatusOK, duplicates)
+}
+
+func handleApiFixtures(w http.ResponseWriter, r *http.Request) {
+	summaries := make([]FixtureSummary, 0)
+	for _, f := range fixtures.list() {
+		summaries = append(summaries, FixtureSummary{Fixture: f, Events: fixtures.events(f.ID)})
+	}
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func handleApiAddFixture(w http.ResponseWriter, r *http.Request) {
+	var body Fixture
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f := &body
+	if f.HomeTeam == "" || f.AwayTeam == "" {
+		described, ok := newFixture(body.Title, body.Venue, body.Kickoff)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("fixtures need homeTeam and awayTeam, or a title like \"Home vs Away\""))
+			return
+		}
+		described.ID = body.ID
+		f = described
+	}
+
+	if err := fixtures.add(f); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	slog.Info("Added fixture", "fixture", f.ID)
+	writeJSON(w, http.StatusCreated, f)
+}
+
+// handleApiLinkEvent links a marketplace event to a fixture by hand, for when
+// matching got it wrong or had nothing to go on.
+func handleApiLinkEvent(w http.ResponseWriter, r *http.Request) {
+	fixtureID, marketplace, eventID := r.PathValue("id"), r.PathValue("marketplace"), r.PathValue("eventId")
+	if err := fixtures.override(marketplace, eventID, fixtureID); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	relink(marketplace, eventID, fixtureID)
+
+	slog.Info("Linked event to fixture", "marketplace", marketplace, "event", eventID, "fixture", fixtureID)
+	writeJSON(w, http.StatusOK, fixtures.events(fixtureID))
+}
+
+func handleApiHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	since, err := parseTime(query.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	until, err := parseTime(query.Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := parseLimit(query.Get("limit"), defaultHistoryLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	observations, err := getObservations(observationFilter{
+		Source:    query.Get("source"),
+		EventID:   query.Get("event"),
+		Section:   query.Get("section"),
+		ListingID: query.Get("listing"),
+		Fixture:   query.Get("fixture"),
+		Since:     since,
+		Until:     until,
+		Limit:     limit,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, observations)
+}
+
+func handleApiSales(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	since, err := parseTime(query.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	until, err := parseTime(query.Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := parseLimit(query.Get("limit"), defaultHistoryLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sales, err := getSales(observationFilter{
+		Source:  query.Get("source"),
+		EventID: query.Get("event"),
+		Section: query.Get("section"),
+		Fixture: query.Get("fixture"),
+		Since:   since,
+		Until:   until,
+		Limit:   limit,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sales)
+}
+
+func handleApiStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := statsQuery{
+		Fixture:   query.Get("fixture"),
+		Source:    query.Get("source"),
+		EventID:   query.Get("event"),
+		Section:   query.Get("section"),
+		BySection: query.Get("bySection") == "true",
+	}
+
+	var err error
+	if q.Since, err = parseTime(query.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if q.Until, err = parseTime(query.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if value := query.Get("interval"); value != "" {
+		if q.Interval, err = time.ParseDuration(value); err != nil || q.Interval <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interval %q", value))
+			return
+		}
+	}
+
+	stats, err := marketStats(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func handleApiAlerts(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"), alertLogSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	alerts, err := getRecentAlerts(r.URL.Query().Get("fixture"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func handleApiPolls(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, watcher.getPolls())
+}
+
+func handleApiWatches(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, registry.list())
+}
+
+func handleApiWatch(w http.ResponseWriter, r *http.Request) {
+	wt, ok := registry.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errWatchNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, wt)
+}
+
+// handleApiForecast forecasts the floor of a watch's current listings, in
+// the currency of the cheapest unless one is asked for.
+func handleApiForecast(w http.ResponseWriter, r *http.Request) {
+	wt, ok := registry.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errWatchNotFound)
+		return
+	}
+
+	tickets := watcher.getListings()[wt.ID]
+	currency := r.URL.Query().Get("currency")
+	if currency == "" && len(tickets) > 0 {
+		cheapest := slices.MinFunc(tickets, func(a, b Ticket) int {
+			return cmp.Compare(a.Price, b.Price)
+		})
+		currency = currencyOf(cheapest)
+	}
+
+	forecast, err := forecasts.forecast(wt, tickets, currency, time.Now())
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, forecast)
+}
+
+func handleApiAddWatch(w http.ResponseWriter, r *http.Request) {
+	var body watch
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	wt, err := newWatch(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := fixtures.link(wt); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := registry.add(wt); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	slog.Info("Added watch", "watch", wt.ID)
+	writeJSON(w, http.StatusCreated, wt)
+}
+
+func handleApiUpdateWatch(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MaxPrice *float64         `json:"maxPrice"`
+		Fixture  *string          `json:"fixture"`
+		Rules    *[]ThresholdRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	wt, err := registry.update(r.PathValue("id"), func(wt *watch) error {
+		if body.MaxPrice != nil {
+			if *body.MaxPrice <= 0 {
+				return fmt.Errorf("maxPrice must be positive")
+			}
+			wt.MaxPrice = *body.MaxPrice
+		}
+		if body.Rules != nil {
+			for _, rule := range *body.Rules {
+				if err := rule.validate(); err != nil {
+					return err
+				}
+			}
+			wt.Rules = *body.Rules
+		}
+		if body.Fixture != nil {
+			if err := fixtures.override(marketplaceOf(wt.Source), wt.EventID, *body.Fixture); err != nil {
+				return err
+			}
+			wt.Fixture = *body.Fixture
+		}
+		return nil
+	})
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	if body.Fixture != nil {
+		relink(marketplaceOf(wt.Source), wt.EventID, wt.Fixture)
+	}
+
+	slog.Info("Updated watch", "watch", wt.ID, "maxPrice", wt.MaxPrice, "fixture", wt.Fixture)
+	writeJSON(w, http.StatusOK, wt)
+}
+
+func handleApiRemoveWatch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	wt, ok := registry.get(id)
+	if !ok || !registry.remove(id) {
+		writeError(w, http.StatusNotFound, errWatchNotFound)
+		return
+	}
+
+	forgetCheapestPrice(wt.Source, wt.EventID)
+
+	watcher.forget(id)
+	scheduler.forget(id)
+	slog.Info("Removed watch", "watch", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleApiSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions := make([]Subscription, 0)
+	for _, wt := range registry.list() {
+		for _, phoneNumber := range wt.PhoneNumbers {
+			subscriptions = append(subscriptions, Subscription{Watch: wt.ID, PhoneNumber: phoneNumber})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, subscriptions)
+}
+
+func handleApiSubscribe(w http.ResponseWriter, r *http.Request) {
+	var body Subscription
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if body.PhoneNumber == "" {
+		writeError(w, http.StatusBadRequest, errors.New("phoneNumber is required"))
+		return
+	}
+
+	wt, err := registry.update(r.PathValue("id"), func(wt *watch) error {
+		if !slices.Contains(wt.PhoneNumbers, body.PhoneNumber) {
+			wt.PhoneNumbers = append(wt.PhoneNumbers, body.PhoneNumber)
+		}
+		return nil
+	})
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, wt)
+}
+
+func handleApiUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	phoneNumber := r.PathValue("phoneNumber")
+
+	wt, err := registry.update(r.PathValue("id"), func(wt *watch) error {
+		i := slices.Index(wt.PhoneNumbers, phoneNumber)
+		if i < 0 {
+			return fmt.Errorf("%s is not subscribed", phoneNumber)
+		}
+		wt.PhoneNumbers = slices.Delete(wt.PhoneNumbers, i, i+1)
+		return nil
+	})
+	if err != nil {
+		writeUpdateError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, wt)
+}
+
+func writeUpdateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errWatchNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, err)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultArchiveDir       = "archive"
+	defaultArchiveRetention = "720h"
+	archivePruneEvery       = time.Hour
+)
+
+type watchKey struct{}
+
+var (
+	archiveDir       string
+	archiveRetention time.Duration
+
+	// sensitiveHeaders aren't archived, so the archive never holds the
+	// session cookies or credentials a request was made with.
+	sensitiveHeaders = []string{"Set-Cookie", "Set-Cookie2", "Cookie", "Authorization", "Proxy-Authorization"}
+	// sensitiveParams are dropped from archived URLs for the same reason,
+	// SEATGEEK_CLIENT_ID among them.
+	sensitiveParams = []string{"client_id", "client_secret", "api_key", "apikey", "key", "token", "access_token", "signature"}
+)
+
+// archivedFetch is one marketplace response as recorded in the fetches
+// table. The body lives in the archive directory under its hash.
+type archivedFetch struct {
+	FetchedAt time.Time
+	PollID    string
+	WatchID   string
+	Source    string
+	EventID   string
+	Method    string
+	URL       string
+	Status    int
+	Header    http.Header
+	Hash      string
+}
+
+// loadArchiveConfig reads ARCHIVE_DIR and ARCHIVE_RETENTION, how long
+// archived fetches are kept. A retention of 0 keeps them forever.
+func loadArchiveConfig() error {
+	archiveDir = envOr("ARCHIVE_DIR", defaultArchiveDir)
+
+	retention, err := time.ParseDuration(envOr("ARCHIVE_RETENTION", defaultArchiveRetention))
+	if err != nil || retention < 0 {
+		return fmt.Errorf("invalid ARCHIVE_RETENTION")
+	}
+	archiveRetention = retention
+
+	return nil
+}
+
+func withWatch(ctx context.Context, w watch) context.Context {
+	return context.WithValue(ctx, watchKey{}, w)
+}
+
+func watchFrom(ctx context.Context) (watch, bool) {
+	w, ok := ctx.Value(watchKey{}).(watch)
+	return w, ok
+}
+
+// archiveResponse stores what was read of a marketplace response.
+func archiveResponse(ctx context.Context, source string, resp *http.Response, body []byte) {
+	archiveFetch(ctx, archivedFetch{
+		Source: source,
+		Method: resp.Request.Method,
+		URL:    resp.Request.URL.String(),
+		Status: resp.StatusCode,
+		Header: archivedHeader(resp.Header),
+	}, body)
+}
+
+// archivedURL is raw without its sensitiveParams.
+func archivedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	query := u.Query()
+	stripped := false
+	for _, name := range sensitiveParams {
+		if query.Has(name) {
+			query.Del(name)
+			stripped = true
+		}
+	}
+	if !stripped {
+		return raw
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func archivedHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range sensitiveHeaders {
+		header.Del(name)
+	}
+	return header
+}
+
+// archiveFetch gzips body into the archive directory, named by the SHA-256 of
+// its contents so identical pages are only stored once, and indexes it with
+// the poll, watch and time it was fetched at.
+func archiveFetch(ctx context.Context, fetch archivedFetch, body []byte) {
+	if archiveDir == "" {
+		return
+	}
+
+	logger := loggerFrom(ctx)
+
+	sum := sha256.Sum256(body)
+	fetch.Hash = hex.EncodeToString(sum[:])
+	fetch.URL = archivedURL(fetch.URL)
+	fetch.FetchedAt = time.Now()
+	fetch.PollID = pollIDFrom(ctx)
+	if w, ok := watchFrom(ctx); ok {
+		fetch.WatchID = w.ID
+		fetch.EventID = w.EventID
+	}
+
+	if err := writeArchiveObject(fetch.Hash, body); err != nil {
+		logger.Warn("Could not archive response", "error", err)
+		return
+	}
+
+	header, err := json.Marshal(fetch.Header)
+	if err != nil {
+		logger.Warn("Could not archive response", "error", err)
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO fetches (fetched_at, poll_id, watch_id, source, event_id, method, url, status, header, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		fetch.FetchedAt.UnixMilli(), fetch.PollID, fetch.WatchID, fetch.Source, fetch.EventID, fetch.Method, fetch.URL, fetch.Status, string(header), fetch.Hash)
+	if err != nil {
+		logger.Warn("Could not index archived response", "error", err)
+	}
+}
+
+func archiveObjectPath(dir, hash string) string {
+	return filepath.Join(dir, "objects", hash[:2], hash+".gz")
+}
+
+func writeArchiveObject(hash string, body []byte) error {
+	// An object that's already there is touched, so pruning sees it as
+	// new again and doesn't remove it before its fetch is indexed.
+	path := archiveObjectPath(archiveDir, hash)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	// Write then rename, so a crash never leaves a truncated object behind
+	// under a valid hash. Polls archiving the same body at once each get
+	// their own temporary file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readArchiveObject(dir, hash string) ([]byte, error) {
+	f, err := os.Open(archiveObjectPath(dir, hash))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
+
+// pruneArchiveLoop keeps the archive to the retention period.
+func pruneArchiveLoop() {
+	for {
+		if err := pruneArchive(time.Now().Add(-archiveRetention)); err != nil {
+			slog.Warn("Could not prune archive", "error", err)
+		}
+		time.Sleep(archivePruneEvery)
+	}
+}
+
+// pruneArchive drops the fetches made before cutoff, then the objects no
+// fetch refers to any more. Objects written since cutoff are left alone, as
+// their fetch may not be indexed yet.
+func pruneArchive(cutoff time.Time) error {
+	if _, err := db.Exec(`DELETE FROM fetches WHERE fetched_at < ?`, cutoff.UnixMilli()); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT DISTINCT hash FROM fetches`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	kept := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		kept[hash] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	removed := 0
+	err = filepath.WalkDir(filepath.Join(archiveDir, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		hash, ok := strings.CutSuffix(d.Name(), ".gz")
+		if ok && kept[hash] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return err
+		}
+
+		removed++
+		return os.Remove(path)
+	})
+	if removed > 0 {
+		slog.Info("Pruned archive", "objects", removed, "before", cutoff)
+	}
+
+	return err
+}
+
+// getFetches returns the archived fetches between since and until, oldest
+// first.
+func getFetches(since, until time.Time) ([]archivedFetch, error) {
+	rows, err := db.Query(`SELECT fetched_at, poll_id, watch_id, source, event_id, method, url, status, header, hash FROM fetches WHERE fetched_at >= ? AND fetched_at < ? ORDER BY fetched_at, rowid`,
+		since.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fetches := make([]archivedFetch, 0)
+	for rows.Next() {
+		var f archivedFetch
+		var fetchedAt int64
+		var header string
+		if err := rows.Scan(&fetchedAt, &f.PollID, &f.WatchID, &f.Source, &f.EventID, &f.Method, &f.URL, &f.Status, &header, &f.Hash); err != nil {
+			return nil, err
+		}
+
+		f.FetchedAt = time.UnixMilli(fetchedAt)
+		if err := json.Unmarshal([]byte(header), &f.Header); err != nil {
+			return nil, fmt.Errorf("bad header for fetch %s: %v", f.Hash, err)
+		}
+
+		fetches = append(fetches, f)
+	}
+
+	return fetches, rows.Err()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestArchivedURL(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"https://seatgeek.com/api/event_listings_v2?id=17&client_id=secret", "https://seatgeek.com/api/event_listings_v2?id=17"},
+		{"https://www.twickets.live/services/g2/inventory/listings/1?api_key=abc", "https://www.twickets.live/services/g2/inventory/listings/1"},
+		// URLs without credentials are left exactly as they were.
+		{"https://www.viagogo.com/E-1?quantity=2&b=1", "https://www.viagogo.com/E-1?quantity=2&b=1"},
+	}
+
+	for _, test := range tests {
+		if got := archivedURL(test.raw); got != test.want {
+			t.Errorf("archivedURL(%q) = %q, want %q", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestWriteArchiveObjectConcurrent(t *testing.T) {
+	archiveDir = t.TempDir()
+	defer func() { archiveDir = "" }()
+
+	body := bytes.Repeat([]byte("listing "), 1<<12)
+	hash := "abcdef"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- writeArchiveObject(hash, body)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	got, err := readArchiveObject(archiveDir, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Error("archived object doesn't match the body written")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// areaWords are dropped when normalising a section or row, so "Block 113",
+// "Section 113" and "113" land in the same area.
+var areaWords = map[string]bool{
+	"section": true,
+	"sec":     true,
+	"block":   true,
+	"blk":     true,
+	"area":    true,
+	"row":     true,
+}
+
+// AreaOffer is the cheapest listing in one seat area of a fixture, across
+// every marketplace watching it. Listings are only compared with others in
+// the same currency.
+type AreaOffer struct {
+	Fixture  string   `json:"fixture"`
+	Area     string   `json:"area"`
+	Currency string   `json:"currency"`
+	Best     Ticket   `json:"best"`
+	Listings int      `json:"listings"`
+	Sources  []string `json:"sources"`
+}
+
+// DuplicateListing is the same seats listed on more than one marketplace.
+type DuplicateListing struct {
+	Fixture string   `json:"fixture"`
+	Area    string   `json:"area"`
+	Row     string   `json:"row"`
+	Seats   string   `json:"seats"`
+	Tickets []Ticket `json:"tickets"`
+}
+
+// fixture is what groups watches of the same game on different marketplaces.
+// Watches without one stand alone.
+func (w watch) fixture() string {
+	if w.Fixture != "" {
+		return w.Fixture
+	}
+	return w.ID
+}
+
+// normaliseArea reduces a section name to the words and numbers that identify
+// it, lowercased and without leading zeros.
+func normaliseArea(section string) string {
+	fields := strings.FieldsFunc(strings.ToLower(section), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if areaWords[field] {
+			continue
+		}
+		if n, err := strconv.Atoi(field); err == nil {
+			field = strconv.Itoa(n)
+		}
+		words = append(words, field)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// seatRange describes count seats starting at first, e.g. "12-13". It's empty
+// when the first seat isn't a number.
+func seatRange(first string, count int) string {
+	n, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || count <= 0 {
+		return ""
+	}
+	if count == 1 {
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%d-%d", n, n+count-1)
+}
+
+func parseSeatRange(seats string) (int, int, bool) {
+	from, to, found := strings.Cut(seats, "-")
+	lo, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !found {
+		return lo, lo, true
+	}
+
+	hi, err := strconv.Atoi(to)
+	if err != nil || hi < lo {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// sameSeats reports whether two listings are for overlapping seats in the
+// same row of the same area. Listings without seat numbers never match.
+func sameSeats(a, b Ticket) bool {
+	if normaliseArea(a.Section) != normaliseArea(b.Section) || normaliseArea(a.Row) != normaliseArea(b.Row) {
+		return false
+	}
+
+	aFrom, aTo, ok := parseSeatRange(a.Seats)
+	if !ok {
+		return false
+	}
+	bFrom, bTo, ok := parseSeatRange(b.Seats)
+	if !ok {
+		return false
+	}
+
+	return aFrom <= bTo && bFrom <= aTo
+}
+
+func currencyOf(t Ticket) string {
+	if t.Currency == "" {
+		return "GBP"
+	}
+	return t.Currency
+}
+
+// fixtureListings groups the current listings of every watch by fixture.
+func fixtureListings() map[string][]Ticket {
+	listings := watcher.getListings()
+
+	byFixture := make(map[string][]Ticket)
+	for _, w := range registry.list() {
+		byFixture[w.fixture()] = append(byFixture[w.fixture()], listings[w.ID]...)
+	}
+
+	return byFixture
+}
+
+// bestByArea returns the cheapest listing of each seat area in a fixture's
+// listings, cheapest area first.
+func bestByArea(fixture string, tickets []Ticket) []AreaOffer {
+	offers := make(map[[2]string]*AreaOffer)
+	for _, t := range tickets {
+		area := normaliseArea(t.Section)
+		key := [2]string{area, currencyOf(t)}
+
+		offer, ok := offers[key]
+		if !ok {
+			offer = &AreaOffer{Fixture: fixture, Area: area, Currency: key[1], Best: t, Sources: []string{}}
+			offers[key] = offer
+		}
+
+		offer.Listings++
+		if t.Price < offer.Best.Price {
+			offer.Best = t
+		}
+		if !slices.Contains(offer.Sources, t.Source) {
+			offer.Sources = append(offer.Sources, t.Source)
+		}
+	}
+
+	areas := make([]AreaOffer, 0, len(offers))
+	for _, offer := range offers {
+		sort.Strings(offer.Sources)
+		areas = append(areas, *offer)
+	}
+
+	sort.Slice(areas, func(i, j int) bool {
+		if areas[i].Best.Price != areas[j].Best.Price {
+			return areas[i].Best.Price < areas[j].Best.Price
+		}
+		return areas[i].Area < areas[j].Area
+	})
+
+	return areas
+}
+
+// findDuplicates returns the seats of a fixture listed on more than one
+// marketplace.
+func findDuplicates(fixture string, tickets []Ticket) []DuplicateListing {
+	duplicates := make([]DuplicateListing, 0)
+	grouped := make(map[string]bool)
+
+	for i, t := range tickets {
+		if grouped[t.Key()] {
+			continue
+		}
+
+		group := []Ticket{t}
+		for _, other := range tickets[i+1:] {
+			if other.Source != t.Source && !grouped[other.Key()] && sameSeats(t, other) {
+				group = append(group, other)
+			}
+		}
+		if len(group) < 2 {
+			continue
+		}
+
+		for _, g := range group {
+			grouped[g.Key()] = true
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Price < group[j].Price
+		})
+
+		duplicates = append(duplicates, DuplicateListing{
+			Fixture: fixture,
+			Area:    normaliseArea(t.Section),
+			Row:     t.Row,
+			Seats:   t.Seats,
+			Tickets: group,
+		})
+	}
+
+	return duplicates
+}
+
+// marketNote puts an alerted listing in the context of the other
+// marketplaces watching its fixture, for the end of the alert text.
+func marketNote(w watch, t Ticket) string {
+	tickets := fixtureListings()[w.fixture()]
+
+	notes := make([]string, 0, 2)
+	for _, other := range tickets {
+		if other.Source != t.Source && sameSeats(t, other) {
+			notes = append(notes, fmt.Sprintf("Same seats on %s for %s.", other.Source, formatPrice(other.Price, other.Currency)))
+		}
+	}
+
+	area := normaliseArea(t.Section)
+	sources := []string{t.Source}
+	cheapest := t
+	for _, other := range tickets {
+		if normaliseArea(other.Section) != area || currencyOf(other) != currencyOf(t) {
+			continue
+		}
+		if !slices.Contains(sources, other.Source) {
+			sources = append(sources, other.Source)
+		}
+		if other.Price < cheapest.Price {
+			cheapest = other
+		}
+	}
+
+	switch {
+	case len(sources) < 2:
+	case cheapest.Key() == t.Key():
+		notes = append(notes, fmt.Sprintf("Cheapest in this area across %d sites.", len(sources)))
+	case sameSeats(t, cheapest):
+	default:
+		notes = append(notes, fmt.Sprintf("%s has this area for %s.", cheapest.Source, formatPrice(cheapest.Price, cheapest.Currency)))
+	}
+
+	return strings.Join(notes, " ")
+}
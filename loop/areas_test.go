@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarketNote(t *testing.T) {
+	viagogo := &watch{ID: "viagogo-notes", Source: "viagogo", EventID: "notes", Fixture: "market-notes"}
+	seatgeek := &watch{ID: "seatgeek-notes", Source: "seatgeek", EventID: "notes", Fixture: "market-notes"}
+	for _, w := range []*watch{viagogo, seatgeek} {
+		if err := registry.add(w); err != nil {
+			t.Fatal(err)
+		}
+		defer registry.remove(w.ID)
+		defer watcher.forget(w.ID)
+	}
+
+	seated := Ticket{Source: "viagogo", ID: "1", Section: "Block 112", Row: "F", Seats: "21-22", Price: 90, Currency: "GBP"}
+	unseated := Ticket{Source: "viagogo", ID: "2", Section: "305", Row: "A", Price: 150, Currency: "GBP"}
+	sameSeatsCheaper := Ticket{Source: "seatgeek", ID: "3", Section: "112", Row: "F", Seats: "22-23", Price: 80, Currency: "GBP"}
+	areaCheaper := Ticket{Source: "seatgeek", ID: "4", Section: "Block 305", Row: "K", Price: 120, Currency: "GBP"}
+	areaDearer := Ticket{Source: "seatgeek", ID: "5", Section: "112", Row: "P", Price: 130, Currency: "GBP"}
+
+	tests := []struct {
+		name   string
+		others []Ticket
+		t      Ticket
+		want   string
+	}{
+		{
+			// A seated listing is the cheapest in its area even though it
+			// has the same seats as itself.
+			name:   "seated cheapest",
+			others: []Ticket{areaDearer},
+			t:      seated,
+			want:   "Cheapest in this area across 2 sites.",
+		},
+		{
+			name:   "cheaper elsewhere",
+			others: []Ticket{areaCheaper},
+			t:      unseated,
+			want:   "seatgeek has this area for £120.00.",
+		},
+		{
+			// The same seats being cheaper elsewhere already says it all.
+			name:   "same seats cheaper",
+			others: []Ticket{sameSeatsCheaper},
+			t:      seated,
+			want:   "Same seats on seatgeek for £80.00.",
+		},
+		{
+			name: "one site",
+			t:    unseated,
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			watcher.recordStart(viagogo.ID, now)
+			watcher.recordSuccess(viagogo.ID, []Ticket{test.t}, now)
+			watcher.recordStart(seatgeek.ID, now)
+			watcher.recordSuccess(seatgeek.ID, test.others, now)
+
+			if got := marketNote(*viagogo, test.t); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	axsOffersUrl = "https://unifiedapicommerce.axs.com/veritix/inventory/v2/%s/offers?includeResale=true"
+	axsEventUrl  = "https://www.axs.com/events/%s"
+	axsQuantity  = 2
+)
+
+// axsPrice is in minor units of the offer's currency.
+type axsPrice struct {
+	Base  int64 `json:"base"`
+	Fees  int64 `json:"fees"`
+	Total int64 `json:"total"`
+}
+
+type axsOffer struct {
+	OfferID      string   `json:"offerId"`
+	OfferType    string   `json:"offerType"`
+	Section      string   `json:"sectionLabel"`
+	Row          string   `json:"rowLabel"`
+	Seats        []string `json:"seats,omitempty"`
+	Quantities   []int    `json:"quantities"`
+	CurrencyCode string   `json:"currencyCode"`
+	Price        axsPrice `json:"price"`
+}
+
+type axsResponse struct {
+	Offers json.RawMessage `json:"offers"`
+}
+
+type axsSource struct {
+	eventID  string
+	quantity int
+	memo     fetchMemo
+}
+
+func (s *axsSource) Name() string {
+	return "axs"
+}
+
+func (s *axsSource) GetTickets(ctx context.Context) ([]Ticket, error) {
+	body, v, err := getListingsJSON(ctx, s.Name(), "axs", fmt.Sprintf(axsOffersUrl, s.eventID), "offers", &s.memo)
+	if err != nil {
+		return nil, err
+	}
+
+	if tickets, ok := s.memo.reuse(s.Name(), body); ok {
+		return tickets, nil
+	}
+
+	tickets, drift, err := parseAxsOffers(ctx, body, s.eventID, s.quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas.report(ctx, s.Name(), s.eventID, drift, body)
+	if len(tickets) == 0 && len(drift.Invalid) > 0 {
+		return nil, schemaChanged("every listing failed validation: %s", drift)
+	}
+
+	s.memo.store(v, body, tickets)
+
+	return tickets, nil
+}
+
+// parseAxsOffers returns the resale offers in an inventory payload that can
+// be bought in the given quantity, priced all-in.
+func parseAxsOffers(ctx context.Context, body []byte, eventID string, quantity int) ([]Ticket, schemaDrift, error) {
+	var data axsResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, schemaDrift{}, schemaChanged("Error parsing JSON: %v", err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data.Offers, &raw); err != nil {
+		return nil, schemaDrift{}, schemaChanged("offers missing: %v", err)
+	}
+
+	var offers []axsOffer
+	if err := json.Unmarshal(data.Offers, &offers); err != nil {
+		return nil, schemaDrift{}, schemaChanged("Error parsing offers: %v", err)
+	}
+
+	drift := compareFields[axsOffer](raw)
+
+	tickets := make([]Ticket, 0)
+	for _, offer := range offers {
+		if !strings.EqualFold(offer.OfferType, "resale") || !slices.Contains(offer.Quantities, quantity) {
+			continue
+		}
+
+		if offer.OfferID == "" {
+			listingsRejected.WithLabelValues("axs", "id").Inc()
+			drift.Invalid["offerId"]++
+			continue
+		}
+
+		if offer.Price.Total <= 0 {
+			listingsRejected.WithLabelValues("axs", "price").Inc()
+			drift.Invalid["price"]++
+			continue
+		}
+
+		if offer.Section == "" {
+			listingsRejected.WithLabelValues("axs", "section").Inc()
+			drift.Invalid["sectionLabel"]++
+			continue
+		}
+
+		listingsParsed.WithLabelValues("axs").Inc()
+		tickets = append(tickets, Ticket{
+			Source:   "axs",
+			EventID:  eventID,
+			ID:       offer.OfferID,
+			Price:    float64(offer.Price.Total) / 100,
+			Fees:     float64(offer.Price.Fees) / 100,
+			Row:      offer.Row,
+			Section:  offer.Section,
+			Seats:    axsSeats(offer.Seats),
+			Quantity: slices.Max(offer.Quantities),
+			Link:     fmt.Sprintf(axsEventUrl, eventID),
+			Currency: offer.CurrencyCode,
+		})
+	}
+
+	return tickets, drift, nil
+}
+
+// axsSeats turns the seat numbers of an offer into a range like "12-13".
+func axsSeats(seats []string) string {
+	if len(seats) == 0 {
+		return ""
+	}
+	return seatRange(seats[0], len(seats))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseAxsOffers(t *testing.T) {
+	body, err := os.ReadFile("testdata/axs-offers.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prices come in pence, with the fees broken out of the total.
+	seated := Ticket{Source: "axs", EventID: "1093847", ID: "RS-5521-0001", Price: 97.75, Fees: 12.75, Row: "F", Section: "Block 112", Seats: "21-22", Quantity: 2, Link: "https://www.axs.com/events/1093847", Currency: "GBP"}
+	noSeats := Ticket{Source: "axs", EventID: "1093847", ID: "RS-5521-0003", Price: 46, Fees: 6, Row: "M", Section: "Block 305", Quantity: 4, Link: "https://www.axs.com/events/1093847", Currency: "GBP"}
+	single := Ticket{Source: "axs", EventID: "1093847", ID: "RS-5521-0004", Price: 59.8, Fees: 7.8, Row: "C", Section: "Block 210", Seats: "7", Quantity: 1, Link: "https://www.axs.com/events/1093847", Currency: "GBP"}
+
+	tests := []struct {
+		name     string
+		quantity int
+		want     []Ticket
+		invalid  map[string]int
+	}{
+		{
+			name:     "pairs",
+			quantity: 2,
+			want:     []Ticket{seated, noSeats},
+			invalid:  map[string]int{"price": 1},
+		},
+		{
+			name:     "singles",
+			quantity: 1,
+			want:     []Ticket{single},
+			invalid:  map[string]int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tickets, drift, err := parseAxsOffers(context.Background(), body, "1093847", test.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(tickets, test.want) {
+				t.Errorf("got tickets\n%+v\nwant\n%+v", tickets, test.want)
+			}
+			if !maps.Equal(drift.Invalid, test.invalid) {
+				t.Errorf("got invalid %v, want %v", drift.Invalid, test.invalid)
+			}
+		})
+	}
+}
+
+func TestParseAxsOffersMissing(t *testing.T) {
+	if _, _, err := parseAxsOffers(context.Background(), []byte(`{"event":{}}`), "1", 2); err == nil {
+		t.Error("expected an error for a payload without offers")
+	}
+}
+
+// TestAxsSource runs polls through GetTickets: every offer comes from one
+// request in the currency it names, an event with no offers is an empty poll
+// rather than an error, and a payload without offers is a schema change.
+func TestAxsSource(t *testing.T) {
+	requested := serveJSON(t,
+		`{"offers":[{"offerId":"RS-1","offerType":"RESALE","sectionLabel":"Block 112","rowLabel":"F","seats":["21","22"],"quantities":[2],"currencyCode":"EUR","price":{"base":8000,"fees":1250,"total":9250}}]}`,
+		`{"offers":[]}`,
+		`{"event":{}}`,
+	)
+	s := &axsSource{eventID: "1093847", quantity: 2}
+
+	tickets, err := s.GetTickets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Ticket{{Source: "axs", EventID: "1093847", ID: "RS-1", Price: 92.5, Fees: 12.5, Row: "F", Section: "Block 112", Seats: "21-22", Quantity: 2, Link: "https://www.axs.com/events/1093847", Currency: "EUR"}}
+	if !reflect.DeepEqual(tickets, want) {
+		t.Errorf("got tickets\n%+v\nwant\n%+v", tickets, want)
+	}
+	if urls := []string{"https://unifiedapicommerce.axs.com/veritix/inventory/v2/1093847/offers?includeResale=true"}; !slices.Equal(*requested, urls) {
+		t.Errorf("requested %v, want %v", *requested, urls)
+	}
+
+	tickets, err = s.GetTickets(context.Background())
+	if err != nil || len(tickets) != 0 {
+		t.Errorf("empty offers gave %v, %v, want no tickets and no error", tickets, err)
+	}
+
+	if _, err := s.GetTickets(context.Background()); fetchClass(err) != fetchSchemaChanged {
+		t.Errorf("payload without offers gave %v, want a schema change", err)
+	}
+}
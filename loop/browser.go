@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/stealth"
+)
+
+// newBrowserPage launches a headless browser and opens a stealth page bound
+// to ctx. The returned func closes the browser. If anything fails after the
+// launch, the browser is killed before the error is returned.
+func newBrowserPage(ctx context.Context) (*rod.Page, func(), error) {
+	l := launcher.New().
+		Headless(true). // Make this false in the future
+		Devtools(false)
+
+	controlUrl, err := l.Launch()
+	if err != nil {
+		l.Kill()
+		return nil, nil, err
+	}
+
+	kill := func() {
+		l.Kill()
+		l.Cleanup()
+	}
+
+	browser := rod.New().ControlURL(controlUrl)
+	if err := browser.Connect(); err != nil {
+		kill()
+		return nil, nil, err
+	}
+
+	browserInstances.Inc()
+	closeBrowser := func() {
+		browser.Close()
+		kill()
+		browserInstances.Dec()
+	}
+
+	if err := browser.IgnoreCertErrors(true); err != nil {
+		closeBrowser()
+		return nil, nil, err
+	}
+
+	page, err := stealth.Page(browser)
+	if err != nil {
+		closeBrowser()
+		return nil, nil, err
+	}
+	page = page.Context(ctx)
+
+	if _, err := page.SetExtraHeaders([]string{"Cache-Control", "no-store"}); err != nil {
+		closeBrowser()
+		return nil, nil, err
+	}
+
+	return page, closeBrowser, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+type validators struct {
+	etag         string
+	lastModified string
+}
+
+func validatorsOf(resp *http.Response) validators {
+	return validators{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// fetchMemo remembers the last payload a source parsed, so unchanged pages
+// can be answered with a 304 or skipped before decoding.
+type fetchMemo struct {
+	mu         sync.Mutex
+	validators validators
+	hash       [sha256.Size]byte
+	tickets    []Ticket
+}
+
+// prepare makes req conditional on the last parsed response.
+func (m *fetchMemo) prepare(req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tickets == nil {
+		return
+	}
+
+	if m.validators.etag != "" {
+		req.Header.Set("If-None-Match", m.validators.etag)
+	}
+	if m.validators.lastModified != "" {
+		req.Header.Set("If-Modified-Since", m.validators.lastModified)
+	}
+}
+
+// reuse returns the tickets parsed last time if payload is nil, meaning the
+// server answered 304, or hashes the same as the last payload.
+func (m *fetchMemo) reuse(source string, payload []byte) ([]Ticket, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tickets == nil {
+		return nil, false
+	}
+
+	if payload == nil {
+		fetchSkips.WithLabelValues(source, "not_modified").Inc()
+		return slices.Clone(m.tickets), true
+	}
+
+	if sha256.Sum256(payload) == m.hash {
+		fetchSkips.WithLabelValues(source, "unchanged").Inc()
+		return slices.Clone(m.tickets), true
+	}
+
+	return nil, false
+}
+
+func (m *fetchMemo) store(v validators, payload []byte, tickets []Ticket) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.validators = v
+	m.hash = sha256.Sum256(payload)
+	m.tickets = slices.Clone(tickets)
+	if m.tickets == nil {
+		m.tickets = []Ticket{}
+	}
+}
+
+// prefixBuffer keeps the first limit bytes written to it, enough to tell a
+// challenge page apart without holding on to a whole document.
+type prefixBuffer struct {
+	limit int
+	buf   []byte
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// countingReader feeds the bytes read from a marketplace into
+// watcher_bytes_fetched_total.
+type countingReader struct {
+	source string
+	r      io.Reader
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	bytesFetched.WithLabelValues(c.source).Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth    = 800
+	chartHeight   = 300
+	historyWindow = 7 * 24 * time.Hour
+	alertLogSize  = 50
+)
+
+var templateFuncs = template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format("Mon 02 Jan 15:04:05")
+	},
+	"price": func(p float64) string {
+		return formatPrice(p, "")
+	},
+	// maskPhone keeps the last three digits, enough to tell numbers apart
+	// on a page anyone on the network can open.
+	"maskPhone": func(phone string) string {
+		if len(phone) <= 3 {
+			return phone
+		}
+		return "•••" + phone[len(phone)-3:]
+	},
+	"ticketPrice": func(t Ticket) string {
+		return formatPrice(t.Price, t.Currency)
+	},
+	"join": func(values []string) string {
+		return strings.Join(values, ", ")
+	},
+}
+
+var currencySymbols = map[string]string{
+	"":    "£",
+	"GBP": "£",
+	"USD": "$",
+	"EUR": "€",
+}
+
+func formatPrice(p float64, currency string) string {
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency + " "
+	}
+	return fmt.Sprintf("%s%.2f", symbol, p)
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="30">
+<title>Ticket watcher</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 4px 10px; border-bottom: 1px solid #ddd; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Ticket watcher</h1>
+
+<h2>Sources</h2>
+<table>
+<tr><th>Watch</th><th>Last poll</th><th>Last success</th><th>Took</th><th>Listings</th><th>Result</th><th>Error</th></tr>
+{{range .Polls}}<tr>
+<td>{{.Watch}}{{if .Stale}} <span class="error">(stale)</span>{{end}}</td><td>{{time .LastPoll}}</td><td>{{time .LastSuccess}}</td><td>{{.Duration}}</td><td>{{.Listings}}</td><td>{{.LastClass}}</td><td class="error">{{.LastError}}</td>
+</tr>{{end}}
+</table>
+
+{{range .Fixtures}}
+<h2>Best by area: {{.Fixture}}</h2>
+<table>
+<tr><th>Area</th><th>Best price</th><th>Source</th><th>Row</th><th>Listings</th><th>Sites</th></tr>
+{{range .Areas}}<tr>
+<td>{{.Area}}</td><td>{{ticketPrice .Best}}</td><td>{{.Best.Source}}</td><td>{{.Best.Row}}</td><td>{{.Listings}}</td><td>{{join .Sources}}</td>
+</tr>{{end}}
+</table>
+{{if .Duplicates}}
+<p>Listed on more than one site:</p>
+<ul>
+{{range .Duplicates}}<li>Area {{.Area}}, row {{.Row}}, seats {{.Seats}}:{{range .Tickets}} <a href="{{.Link}}">{{.Source}} {{ticketPrice .}}</a>{{end}}</li>
+{{end}}
+</ul>
+{{end}}
+{{end}}
+
+{{range .Events}}
+<h2>{{.Source}} event {{.EventID}}</h2>
+<table>
+<tr><th><a href="?sort=price">Price</a></th><th><a href="?sort=score">Score</a></th><th>Section</th><th>Row</th><th>Listing</th></tr>
+{{range .Tickets}}<tr>
+<td>{{ticketPrice .}}</td><td>{{if .Score}}{{printf "%.1f" .Score}}{{end}}</td>
+<td><a href="/history?source={{.Source}}&event={{.EventID}}&section={{.Section}}">{{.Section}}</a></td>
+<td>{{.Row}}</td><td><a href="{{.Link}}">{{.ID}}</a></td>
+</tr>{{end}}
+</table>
+{{end}}
+
+<h2>Recent alerts</h2>
+<table>
+<tr><th>Sent</th><th>Source</th><th>Price</th><th>Section</th><th>Row</th><th>To</th><th>Error</th></tr>
+{{range .Alerts}}<tr>
+<td>{{time .SentAt}}</td><td>{{.Ticket.Source}}</td><td>{{ticketPrice .Ticket}}</td><td>{{.Ticket.Section}}</td><td>{{.Ticket.Row}}</td><td>{{maskPhone .PhoneNumber}}</td><td class="error">{{.Error}}</td>
+</tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+var historyPage = template.Must(template.New("history").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Source}} section {{.Section}}</title>
+<style>body { font-family: sans-serif; margin: 2em; }</style>
+</head>
+<body>
+<p><a href="/">Back</a></p>
+<h1>{{.Source}} event {{.EventID}}, section {{.Section}}</h1>
+{{if .Points}}
+<p>Cheapest listing from {{time .From}} to {{time .To}}, between {{price .Min}} and {{price .Max}}.</p>
+<svg width="{{.Width}}" height="{{.Height}}" style="border: 1px solid #ddd">
+<polyline fill="none" stroke="#0b62d6" stroke-width="2" points="{{.Points}}"/>
+</svg>
+{{else}}
+<p>No history for this section yet.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// fixtureAreas is shown for fixtures watched on more than one marketplace.
+type fixtureAreas struct {
+	Fixture    string
+	Areas      []AreaOffer
+	Duplicates []DuplicateListing
+}
+
+type eventListings struct {
+	Source  string
+	EventID string
+	Tickets []Ticket
+}
+
+type historyPageData struct {
+	Source, EventID, Section string
+	From, To                 time.Time
+	Min, Max                 float64
+	Width, Height            int
+	Points                   string
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	sortBy := r.URL.Query().Get("sort")
+
+	byEvent := make(map[[2]string][]Ticket)
+	for _, tickets := range watcher.getListings() {
+		for _, t := range tickets {
+			if state, ok := store.get(t.Key()); ok && state.Blacklisted {
+				continue
+			}
+
+			key := [2]string{t.Source, t.EventID}
+			byEvent[key] = append(byEvent[key], t)
+		}
+	}
+
+	events := make([]eventListings, 0, len(byEvent))
+	for key, tickets := range byEvent {
+		sort.Slice(tickets, func(i, j int) bool {
+			if sortBy == "score" {
+				return tickets[i].Score > tickets[j].Score
+			}
+			return tickets[i].Price < tickets[j].Price
+		})
+
+		events = append(events, eventListings{Source: key[0], EventID: key[1], Tickets: tickets})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Source != events[j].Source {
+			return events[i].Source < events[j].Source
+		}
+		return events[i].EventID < events[j].EventID
+	})
+
+	sources := make(map[string]map[string]bool)
+	for _, wt := range registry.list() {
+		if sources[wt.fixture()] == nil {
+			sources[wt.fixture()] = make(map[string]bool)
+		}
+		sources[wt.fixture()][wt.Source] = true
+	}
+
+	fixtures := make([]fixtureAreas, 0)
+	for fixture, tickets := range fixtureListings() {
+		if len(sources[fixture]) < 2 {
+			continue
+		}
+		fixtures = append(fixtures, fixtureAreas{
+			Fixture:    fixture,
+			Areas:      bestByArea(fixture, tickets),
+			Duplicates: findDuplicates(fixture, tickets),
+		})
+	}
+
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtures[i].Fixture < fixtures[j].Fixture
+	})
+
+	alerts, err := getRecentAlerts("", alertLogSize)
+	if err != nil {
+		slog.Error("Error loading alerts", "error", err)
+	}
+
+	data := map[string]interface{}{
+		"Polls":    watcher.getPolls(),
+		"Fixtures": fixtures,
+		"Events":   events,
+		"Alerts":   alerts,
+	}
+
+	if err := dashboardPage.Execute(w, data); err != nil {
+		slog.Error("Error rendering dashboard", "error", err)
+	}
+}
+
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := historyPageData{
+		Source:  query.Get("source"),
+		EventID: query.Get("event"),
+		Section: query.Get("section"),
+		Width:   chartWidth,
+		Height:  chartHeight,
+	}
+
+	points, err := getSectionHistory(data.Source, data.EventID, data.Section, time.Now().Add(-historyWindow))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(points) > 0 {
+		data.From = points[0].At
+		data.To = time.Now()
+		data.Min, data.Max = points[0].Price, points[0].Price
+		for _, p := range points {
+			data.Min = min(data.Min, p.Price)
+			data.Max = max(data.Max, p.Price)
+		}
+		data.Points = chartPoints(points, data.From, data.To, data.Min, data.Max)
+	}
+
+	if err := historyPage.Execute(w, data); err != nil {
+		slog.Error("Error rendering history", "error", err)
+	}
+}
+
+// chartPoints lays the history out as a step line, since each price holds
+// until the next snapshot.
+func chartPoints(points []PricePoint, from, to time.Time, low, high float64) string {
+	span := to.Sub(from).Seconds()
+	if span <= 0 {
+		span = 1
+	}
+
+	spread := high - low
+	if spread == 0 {
+		spread = 1
+	}
+
+	x := func(t time.Time) float64 {
+		return t.Sub(from).Seconds() / span * chartWidth
+	}
+	y := func(p float64) float64 {
+		return chartHeight - 10 - (p-low)/spread*(chartHeight-20)
+	}
+
+	coords := make([]string, 0, len(points)*2+1)
+	for i, p := range points {
+		if i > 0 {
+			coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(p.At), y(points[i-1].Price)))
+		}
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(p.At), y(p.Price)))
+	}
+	coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(to), y(points[len(points)-1].Price)))
+
+	return strings.Join(coords, " ")
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type exportKind int
+
+const (
+	exportString exportKind = iota
+	exportTime
+	exportFloat
+)
+
+type exportColumn struct {
+	name string
+	kind exportKind
+}
+
+// exportTable is one dataset to export. Rows hold a string, time.Time or
+// float64 for each column.
+type exportTable struct {
+	name    string
+	columns []exportColumn
+	rows    [][]any
+}
+
+var exportFormats = map[string]struct {
+	extension string
+	write     func(io.Writer, exportTable) error
+}{
+	"csv":     {"csv", writeCSV},
+	"jsonl":   {"jsonl", writeJSONLines},
+	"parquet": {"parquet", writeParquet},
+}
+
+var exportDatasets = []string{"observations", "sales", "alerts"}
+
+// fixtureColumn names the fixture a marketplace event is linked to, so rows
+// from different marketplaces can be joined up.
+func fixtureColumn(t Ticket) string {
+	fixtureID, _ := fixtures.fixtureOf(marketplaceOf(t.Source), t.EventID)
+	return fixtureID
+}
+
+func exportObservations(filter observationFilter) (exportTable, error) {
+	table := exportTable{
+		name: "observations",
+		columns: []exportColumn{
+			{"observed_at", exportTime},
+			{"source", exportString},
+			{"event_id", exportString},
+			{"fixture", exportString},
+			{"listing_id", exportString},
+			{"section", exportString},
+			{"row", exportString},
+			{"price", exportFloat},
+			{"currency", exportString},
+			{"score", exportFloat},
+		},
+	}
+
+	observations, err := getObservations(filter)
+	if err != nil {
+		return table, err
+	}
+
+	for _, o := range observations {
+		t := o.Ticket
+		table.rows = append(table.rows, []any{o.ObservedAt, t.Source, t.EventID, fixtureColumn(t), t.ID, t.Section, t.Row, t.Price, currencyOf(t), t.Score})
+	}
+
+	return table, nil
+}
+
+func exportSales(filter observationFilter) (exportTable, error) {
+	table := exportTable{
+		name: "sales",
+		columns: []exportColumn{
+			{"sold_at", exportTime},
+			{"source", exportString},
+			{"event_id", exportString},
+			{"fixture", exportString},
+			{"listing_id", exportString},
+			{"section", exportString},
+			{"row", exportString},
+			{"price", exportFloat},
+			{"currency", exportString},
+			{"evidence", exportString},
+		},
+	}
+
+	sales, err := getSales(filter)
+	if err != nil {
+		return table, err
+	}
+
+	for _, s := range sales {
+		t := s.Ticket
+		table.rows = append(table.rows, []any{s.SoldAt, t.Source, t.EventID, fixtureColumn(t), t.ID, t.Section, t.Row, t.Price, currencyOf(t), s.Evidence})
+	}
+
+	return table, nil
+}
+
+func exportAlerts(filter observationFilter) (exportTable, error) {
+	table := exportTable{
+		name: "alerts",
+		columns: []exportColumn{
+			{"sent_at", exportTime},
+			{"source", exportString},
+			{"event_id", exportString},
+			{"fixture", exportString},
+			{"listing_id", exportString},
+			{"section", exportString},
+			{"row", exportString},
+			{"price", exportFloat},
+			{"phone_number", exportString},
+			{"error", exportString},
+		},
+	}
+
+	alerts, err := getAlerts(filter)
+	if err != nil {
+		return table, err
+	}
+
+	for _, a := range alerts {
+		t := a.Ticket
+		table.rows = append(table.rows, []any{a.SentAt, t.Source, t.EventID, fixtureColumn(t), t.ID, t.Section, t.Row, t.Price, a.PhoneNumber, a.Error})
+	}
+
+	return table, nil
+}
+
+func formatExportValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeCSV(out io.Writer, table exportTable) error {
+	w := csv.NewWriter(out)
+
+	header := make([]string, len(table.columns))
+	for i, c := range table.columns {
+		header[i] = c.name
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(table.columns))
+	for _, row := range table.rows {
+		for i, v := range row {
+			record[i] = formatExportValue(v)
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// writeJSONLines writes a JSON object per row, with the keys in column
+// order.
+func writeJSONLines(out io.Writer, table exportTable) error {
+	w := bufio.NewWriter(out)
+
+	for _, row := range table.rows {
+		w.WriteByte('{')
+		for i, v := range row {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if t, ok := v.(time.Time); ok {
+				v = t.UTC()
+			}
+
+			key, _ := json.Marshal(table.columns[i].name)
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			w.Write(key)
+			w.WriteByte(':')
+			w.Write(value)
+		}
+		w.WriteString("}\n")
+	}
+
+	return w.Flush()
+}
+
+// writeParquet writes a table as a Snappy compressed Parquet file, every
+// column required and in table order. Times are UTC millisecond timestamps.
+func writeParquet(out io.Writer, table exportTable) error {
+	// A struct type keeps the columns in order, where a parquet.Group would
+	// sort them by name.
+	fields := make([]reflect.StructField, len(table.columns))
+	for i, c := range table.columns {
+		tag, typ := c.name, reflect.TypeFor[string]()
+		switch c.kind {
+		case exportTime:
+			tag, typ = c.name+",timestamp(millisecond)", reflect.TypeFor[time.Time]()
+		case exportFloat:
+			typ = reflect.TypeFor[float64]()
+		}
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("C%d", i), Type: typ, Tag: reflect.StructTag(fmt.Sprintf("parquet:%q", tag))}
+	}
+	schema := parquet.NewSchema(table.name, parquet.SchemaOf(reflect.New(reflect.StructOf(fields)).Interface()))
+
+	w := parquet.NewWriter(out, schema, parquet.Compression(&parquet.Snappy))
+
+	for _, r := range table.rows {
+		row := make(parquet.Row, len(r))
+		for i, v := range r {
+			switch v := v.(type) {
+			case time.Time:
+				row[i] = parquet.Int64Value(v.UnixMilli())
+			case float64:
+				row[i] = parquet.DoubleValue(v)
+			case string:
+				row[i] = parquet.ByteArrayValue([]byte(v))
+			default:
+				return fmt.Errorf("can't write %T to %s.%s", v, table.name, table.columns[i].name)
+			}
+			row[i] = row[i].Level(0, 0, i)
+		}
+
+		if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// parseFeeds reads a comma separated list of events, each a fixture ID or
+// source:eventId, into the feeds they cover.
+func parseFeeds(events string) ([][2]string, error) {
+	feeds := make([][2]string, 0)
+	for _, event := range strings.Split(events, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+
+		if source, eventID, ok := strings.Cut(event, ":"); ok {
+			feeds = append(feeds, [2]string{source, eventID})
+			continue
+		}
+
+		if _, ok := fixtures.get(event); !ok {
+			return nil, fmt.Errorf("unknown fixture %q", event)
+		}
+		feeds = append(feeds, fixtureFeeds(event)...)
+	}
+
+	return feeds, nil
+}
+
+// runExport writes stored observations, sales and alerts to one file per
+// dataset, for loading into notebooks.
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "csv", "csv, jsonl or parquet")
+	out := flags.String("out", ".", "directory to write the files to")
+	events := flags.String("events", "", "comma separated fixture IDs and source:eventId pairs, defaults to every event")
+	datasets := flags.String("data", strings.Join(exportDatasets, ","), "comma separated datasets to export")
+	from := flags.String("from", "", "start of the range (RFC3339)")
+	to := flags.String("to", "", "end of the range (RFC3339)")
+	flags.Parse(args)
+
+	writer, ok := exportFormats[*format]
+	if !ok {
+		fatal("Unknown export format", "format", *format)
+	}
+
+	var filter observationFilter
+	var err error
+	if filter.Since, err = parseTime(*from); err != nil {
+		fatal("Invalid -from", "error", err)
+	}
+	if filter.Until, err = parseTime(*to); err != nil {
+		fatal("Invalid -to", "error", err)
+	}
+
+	if *events != "" {
+		if filter.Feeds, err = parseFeeds(*events); err != nil {
+			fatal("Invalid -events", "error", err)
+		}
+		if len(filter.Feeds) == 0 {
+			fatal("No marketplace events to export", "events", *events)
+		}
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fatal("Error creating export directory", "error", err)
+	}
+
+	for _, dataset := range strings.Split(*datasets, ",") {
+		dataset = strings.TrimSpace(dataset)
+		if !slices.Contains(exportDatasets, dataset) {
+			fatal("Unknown dataset", "dataset", dataset)
+		}
+
+		var table exportTable
+		switch dataset {
+		case "observations":
+			table, err = exportObservations(filter)
+		case "sales":
+			table, err = exportSales(filter)
+		case "alerts":
+			table, err = exportAlerts(filter)
+		}
+		if err != nil {
+			fatal("Error reading "+dataset, "error", err)
+		}
+
+		path := filepath.Join(*out, table.name+"."+writer.extension)
+		if err := writeExportFile(path, table, writer.write); err != nil {
+			fatal("Error writing export", "path", path, "error", err)
+		}
+
+		slog.Info("Exported", "dataset", dataset, "rows", len(table.rows), "path", path)
+	}
+}
+
+func writeExportFile(path string, table exportTable, write func(io.Writer, exportTable) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f, table); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	probeInterval    = 1 * time.Minute
+	maxProbeInterval = 15 * time.Minute
+)
+
+// fallbackSource polls primary while it works and switches to fallback when
+// it doesn't, probing primary again with a growing interval until it
+// recovers. Tickets from either side are reported under the same source
+// name, and fallback tickets take the ID and link of the primary listing with
+// the same section, row and price so alerts and dedupe don't see them as new.
+// Each ticket keeps the source it came from as its Origin.
+type fallbackSource struct {
+	name     string
+	eventID  string
+	primary  Source
+	fallback Source
+	// probe, when set, decides whether primary is tried instead of the probe
+	// schedule. Replays use it to follow what the live poll did.
+	probe func(ctx context.Context) bool
+
+	mu            sync.Mutex
+	usingFallback bool
+	nextProbe     time.Time
+	probes        int
+	lastPrimary   []Ticket
+}
+
+func newFallbackSource(name, eventID string, primary, fallback Source) *fallbackSource {
+	return &fallbackSource{
+		name:     name,
+		eventID:  eventID,
+		primary:  primary,
+		fallback: fallback,
+	}
+}
+
+func (s *fallbackSource) Name() string {
+	return s.name
+}
+
+func (s *fallbackSource) GetTickets(ctx context.Context) ([]Ticket, error) {
+	logger := loggerFrom(ctx)
+
+	s.mu.Lock()
+	tryPrimary := !s.usingFallback || !time.Now().Before(s.nextProbe)
+	s.mu.Unlock()
+	if s.probe != nil {
+		tryPrimary = s.probe(ctx)
+	}
+
+	if tryPrimary {
+		tickets, err := s.primary.GetTickets(ctx)
+		if err == nil {
+			s.primarySucceeded(ctx, tickets)
+			return s.rename(tickets), nil
+		}
+
+		logger.Warn("Primary source failed, using fallback", "primary", s.primary.Name(), "fallback", s.fallback.Name(), "error", err)
+		s.primaryFailed(ctx)
+	}
+
+	tickets, err := s.fallback.GetTickets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.matchPrimary(s.rename(tickets)), nil
+}
+
+func (s *fallbackSource) primarySucceeded(ctx context.Context, tickets []Ticket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastPrimary = tickets
+	s.probes = 0
+
+	if s.usingFallback {
+		s.usingFallback = false
+		sourceSwitches.WithLabelValues(s.name, s.primary.Name()).Inc()
+		fallbackActive.WithLabelValues(s.name, s.eventID).Set(0)
+		loggerFrom(ctx).Info("Primary source recovered", "primary", s.primary.Name())
+	}
+}
+
+func (s *fallbackSource) primaryFailed(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.probes++
+	wait := time.Duration(float64(probeInterval) * math.Pow(2, float64(s.probes-1)))
+	s.nextProbe = time.Now().Add(min(wait, maxProbeInterval))
+
+	if !s.usingFallback {
+		s.usingFallback = true
+		sourceSwitches.WithLabelValues(s.name, s.fallback.Name()).Inc()
+		fallbackActive.WithLabelValues(s.name, s.eventID).Set(1)
+	}
+}
+
+// rename reports tickets under s.name, keeping the source they came from as
+// their origin.
+func (s *fallbackSource) rename(tickets []Ticket) []Ticket {
+	renamed := make([]Ticket, len(tickets))
+	for i, t := range tickets {
+		t.Origin = t.origin()
+		t.Source = s.name
+		renamed[i] = t
+	}
+
+	return renamed
+}
+
+func (s *fallbackSource) matchPrimary(tickets []Ticket) []Ticket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range tickets {
+		for _, p := range s.lastPrimary {
+			if p.Section == t.Section && p.Row == t.Row && math.Abs(p.Price-t.Price) < 0.01 {
+				tickets[i].ID = p.ID
+				tickets[i].Link = p.Link
+				break
+			}
+		}
+	}
+
+	return tickets
+}
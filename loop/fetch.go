@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fetch classes describe what a marketplace actually gave us back, so the
+// loop can react to a captcha differently from a rate limit or an outage.
+const (
+	fetchOK            = "ok"
+	fetchEmpty         = "empty"
+	fetchRateLimited   = "rate_limited"
+	fetchChallenge     = "challenge"
+	fetchMaintenance   = "maintenance"
+	fetchSchemaChanged = "schema_changed"
+	fetchFailed        = "failed"
+)
+
+var (
+	challengeMarkers = []string{
+		"captcha",
+		"cf-chl-",
+		"challenge-platform",
+		"attention required",
+		"px-captcha",
+		"datadome",
+		"are you a robot",
+		"verify you are human",
+		"access denied",
+	}
+
+	maintenanceMarkers = []string{
+		"maintenance",
+		"be back soon",
+		"temporarily unavailable",
+	}
+)
+
+type FetchError struct {
+	Class      string
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s (status %d): %v", e.Class, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchClass returns the class of an error returned by a source. Errors
+// that weren't classified by the fetch layer count as plain failures.
+func fetchClass(err error) string {
+	if err == nil {
+		return fetchOK
+	}
+
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Class
+	}
+
+	return fetchFailed
+}
+
+func schemaChanged(format string, args ...interface{}) *FetchError {
+	return &FetchError{Class: fetchSchemaChanged, Err: fmt.Errorf(format, args...)}
+}
+
+// classifyResponse looks at the status, headers and body of a marketplace
+// response and returns an error for anything that isn't a normal page. A
+// nil result means the body is worth parsing. expect is a marker every real
+// page contains, used to tell a 200 interstitial from a page that merely
+// mentions a captcha somewhere.
+func classifyResponse(resp *http.Response, body []byte, expect string) *FetchError {
+	lower := bytes.ToLower(body)
+	hasMarker := func(markers []string) bool {
+		for _, marker := range markers {
+			if bytes.Contains(lower, []byte(marker)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	fetchErr := &FetchError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		fetchErr.Class = fetchRateLimited
+		fetchErr.Err = fmt.Errorf("rate limited")
+	case resp.Header.Get("cf-mitigated") == "challenge" || resp.Header.Get("x-datadome") != "":
+		fetchErr.Class = fetchChallenge
+		fetchErr.Err = fmt.Errorf("bot challenge served")
+	case (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusServiceUnavailable) && hasMarker(challengeMarkers):
+		fetchErr.Class = fetchChallenge
+		fetchErr.Err = fmt.Errorf("bot challenge served")
+	case resp.StatusCode == http.StatusServiceUnavailable && hasMarker(maintenanceMarkers):
+		fetchErr.Class = fetchMaintenance
+		fetchErr.Err = fmt.Errorf("site under maintenance")
+	case resp.StatusCode == http.StatusForbidden:
+		// A bare 403 from these sites is almost always the bot wall.
+		fetchErr.Class = fetchChallenge
+		fetchErr.Err = fmt.Errorf("forbidden")
+	case resp.StatusCode != http.StatusOK:
+		fetchErr.Class = fetchFailed
+		fetchErr.Err = fmt.Errorf("unexpected status")
+	case isHtml(resp) && hasMarker(challengeMarkers) && (expect == "" || !bytes.Contains(body, []byte(expect))):
+		// Some walls answer 200 with an interstitial page.
+		fetchErr.Class = fetchChallenge
+		fetchErr.Err = fmt.Errorf("challenge page served with status 200")
+	default:
+		return nil
+	}
+
+	return fetchErr
+}
+
+func isHtml(resp *http.Response) bool {
+	return strings.Contains(resp.Header.Get("Content-Type"), "text/html")
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
+
+// getListingsJSON fetches a marketplace's listing JSON, conditional on the
+// last response memo parsed. A nil payload means the server answered 304.
+// expect is passed to classifyResponse.
+func getListingsJSON(ctx context.Context, source, marketplace, url, expect string, memo *fetchMemo) ([]byte, validators, error) {
+	req, err := newRequest(ctx, marketplace, "GET", url, nil)
+	if err != nil {
+		return nil, validators{}, fmt.Errorf("Error creating request: %v", err)
+	}
+	memo.prepare(req)
+
+	resp, err := doRequest(req)
+	if err != nil {
+		return nil, validators{}, fmt.Errorf("Error making HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	observeHttpResponse(source, resp.StatusCode)
+
+	if resp.StatusCode == http.StatusNotModified {
+		archiveResponse(ctx, source, resp, nil)
+		return nil, validators{}, nil
+	}
+
+	body, err := io.ReadAll(&countingReader{source: source, r: resp.Body})
+	if err != nil {
+		return nil, validators{}, fmt.Errorf("Error reading response body: %v", err)
+	}
+	capturePage(ctx, source, "json", body)
+	archiveResponse(ctx, source, resp, body)
+
+	if fetchErr := classifyResponse(resp, body, expect); fetchErr != nil {
+		return nil, validators{}, fetchErr
+	}
+
+	return body, validatorsOf(resp), nil
+}
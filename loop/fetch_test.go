@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// serveJSON answers every marketplace request with the given bodies in turn
+// until the test ends, and returns the URLs requested.
+func serveJSON(t *testing.T, bodies ...string) *[]string {
+	requested := make([]string, 0)
+	client := httpClient
+	t.Cleanup(func() { httpClient = client })
+
+	httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if len(requested) == len(bodies) {
+			return nil, fmt.Errorf("unexpected request for %s", req.URL)
+		}
+		body := bodies[len(requested)]
+		requested = append(requested, req.URL.String())
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})}
+
+	return &requested
+}
+
+func TestFetchClassWrapped(t *testing.T) {
+	challenge := &FetchError{Class: fetchChallenge, Err: fmt.Errorf("bot challenge served")}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, fetchOK},
+		{"plain", fmt.Errorf("connection reset"), fetchFailed},
+		{"classified", challenge, fetchChallenge},
+		{"wrapped", fmt.Errorf("twickets api: %w", challenge), fetchChallenge},
+		{"wrapped twice", fmt.Errorf("fallback: %w", fmt.Errorf("api: %w", schemaChanged("no items"))), fetchSchemaChanged},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := fetchClass(test.err); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerRetryAfterWrapped(t *testing.T) {
+	s := &pollScheduler{plans: make(map[string]*pollPlan)}
+	w := watch{ID: "twickets-1"}
+	now := time.Now()
+
+	err := fmt.Errorf("api: %w", &FetchError{Class: fetchRateLimited, RetryAfter: time.Hour, Err: fmt.Errorf("rate limited")})
+	s.react(w, err, fetchClass(err), now)
+
+	if s.shouldPoll(w, now.Add(30*time.Minute)) {
+		t.Error("polled before the wrapped error's Retry-After")
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fixtureMatchScore is how alike an event has to be to a known fixture
+	// to be linked to it automatically.
+	fixtureMatchScore = 0.6
+	// Marketplaces list kickoff in different time zones, or not at all.
+	fixtureKickoffSlack = 36 * time.Hour
+)
+
+var (
+	teamSeparator = regexp.MustCompile(`(?i)\s+(vs\.?|v\.?|versus|at|@)\s+`)
+
+	// nameStopWords don't tell teams or venues apart.
+	nameStopWords = map[string]bool{
+		"the":     true,
+		"fc":      true,
+		"nfl":     true,
+		"tickets": true,
+		"game":    true,
+		"stadium": true,
+	}
+
+	// marketplaceSources are the sources that read the same marketplace
+	// events, and so share their event IDs.
+	marketplaceSources = map[string][]string{
+		"twickets": {"twickets", "twickets-api", "twickets-browser"},
+	}
+)
+
+// Fixture is a real-world game, which each marketplace lists under its own
+// event ID.
+type Fixture struct {
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	HomeTeam string     `json:"homeTeam"`
+	AwayTeam string     `json:"awayTeam"`
+	Venue    string     `json:"venue,omitempty"`
+	Kickoff  *time.Time `json:"kickoff,omitempty"`
+}
+
+// EventLink ties a marketplace event to a fixture. Manual links are never
+// replaced by matching.
+type EventLink struct {
+	Marketplace string  `json:"marketplace"`
+	EventID     string  `json:"eventId"`
+	Fixture     string  `json:"fixture"`
+	Manual      bool    `json:"manual"`
+	Score       float64 `json:"score,omitempty"`
+}
+
+type fixtureRegistry struct {
+	mu       sync.Mutex
+	fixtures map[string]*Fixture
+	links    map[[2]string]EventLink
+}
+
+var (
+	fixtures = &fixtureRegistry{
+		fixtures: make(map[string]*Fixture),
+		links:    make(map[[2]string]EventLink),
+	}
+)
+
+func marketplaceOf(source string) string {
+	for marketplace, sources := range marketplaceSources {
+		if slices.Contains(sources, source) {
+			return marketplace
+		}
+	}
+	return source
+}
+
+// newFixture describes the game a watch is for from its title, venue and
+// kickoff. Titles are "Home vs Away", "Home v Away" or "Away at Home".
+func newFixture(title, venue string, kickoff *time.Time) (*Fixture, bool) {
+	match := teamSeparator.FindStringSubmatchIndex(title)
+	if match == nil {
+		return nil, false
+	}
+
+	home := strings.TrimSpace(title[:match[0]])
+	away := strings.TrimSpace(title[match[1]:])
+	separator := strings.ToLower(title[match[2]:match[3]])
+	if separator == "at" || separator == "@" {
+		home, away = away, home
+	}
+
+	if home == "" || away == "" {
+		return nil, false
+	}
+
+	return &Fixture{
+		Title:    strings.TrimSpace(title),
+		HomeTeam: home,
+		AwayTeam: away,
+		Venue:    strings.TrimSpace(venue),
+		Kickoff:  kickoff,
+	}, true
+}
+
+func nameTokens(name string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if !nameStopWords[field] {
+			tokens[field] = true
+		}
+	}
+	return tokens
+}
+
+// teamKey reduces a team name to the words nameTokens keeps, sorted, so
+// "The Chicago Bears" and "Chicago Bears" are the same team.
+func teamKey(name string) string {
+	return strings.Join(slices.Sorted(maps.Keys(nameTokens(name))), " ")
+}
+
+// nameSimilarity is the share of the shorter name's words found in the other,
+// so "Chicago Bears" and "Bears" match fully.
+func nameSimilarity(a, b string) float64 {
+	aTokens, bTokens := nameTokens(a), nameTokens(b)
+	if len(aTokens) == 0 || len(bTokens) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for token := range aTokens {
+		if bTokens[token] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(min(len(aTokens), len(bTokens)))
+}
+
+// matchScore rates how likely two descriptions are the same game, from 0 to
+// 1. Marketplaces disagree on which team is at home, so either order counts.
+func matchScore(a, b *Fixture) float64 {
+	if a.Kickoff != nil && b.Kickoff != nil {
+		diff := a.Kickoff.Sub(*b.Kickoff)
+		if diff > fixtureKickoffSlack || diff < -fixtureKickoffSlack {
+			return 0
+		}
+	}
+
+	same := (nameSimilarity(a.HomeTeam, b.HomeTeam) + nameSimilarity(a.AwayTeam, b.AwayTeam)) / 2
+	crossed := (nameSimilarity(a.HomeTeam, b.AwayTeam) + nameSimilarity(a.AwayTeam, b.HomeTeam)) / 2
+	score := max(same, crossed)
+
+	if a.Venue != "" && b.Venue != "" {
+		score *= 0.5 + 0.5*nameSimilarity(a.Venue, b.Venue)
+	}
+
+	return score
+}
+
+// titleFromUrl reads an event title from the path segment before the one
+// starting with marker, e.g. "Bears-vs-Jaguars" in a viagogo event URL.
+func titleFromUrl(rawUrl, marker string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if strings.HasPrefix(segments[i], marker) {
+			return strings.ReplaceAll(segments[i-1], "-", " ")
+		}
+	}
+
+	return ""
+}
+
+func fixtureSlug(f *Fixture) string {
+	parts := []string{f.HomeTeam, f.AwayTeam}
+	if f.Kickoff != nil {
+		parts = append(parts, f.Kickoff.UTC().Format("2006-01-02"))
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(strings.Join(parts, " ")), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	return strings.Join(words, "-")
+}
+
+// load reads the fixtures and event links saved by earlier runs.
+func (r *fixtureRegistry) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rows, err := db.Query(`SELECT id, title, home_team, away_team, venue, kickoff FROM fixtures`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Fixture
+		var kickoff int64
+		if err := rows.Scan(&f.ID, &f.Title, &f.HomeTeam, &f.AwayTeam, &f.Venue, &kickoff); err != nil {
+			return err
+		}
+		if kickoff != 0 {
+			t := time.Unix(kickoff, 0)
+			f.Kickoff = &t
+		}
+		r.fixtures[f.ID] = &f
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	links, err := db.Query(`SELECT marketplace, event_id, fixture_id, manual, score FROM event_links`)
+	if err != nil {
+		return err
+	}
+	defer links.Close()
+
+	for links.Next() {
+		var link EventLink
+		if err := links.Scan(&link.Marketplace, &link.EventID, &link.Fixture, &link.Manual, &link.Score); err != nil {
+			return err
+		}
+		r.links[[2]string{link.Marketplace, link.EventID}] = link
+	}
+
+	return links.Err()
+}
+
+func (r *fixtureRegistry) saveFixture(f *Fixture) error {
+	var kickoff int64
+	if f.Kickoff != nil {
+		kickoff = f.Kickoff.Unix()
+	}
+
+	_, err := db.Exec(`INSERT OR REPLACE INTO fixtures (id, title, home_team, away_team, venue, kickoff) VALUES (?, ?, ?, ?, ?, ?)`,
+		f.ID, f.Title, f.HomeTeam, f.AwayTeam, f.Venue, kickoff)
+	if err != nil {
+		return err
+	}
+
+	r.fixtures[f.ID] = f
+	return nil
+}
+
+func (r *fixtureRegistry) saveLink(link EventLink) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO event_links (marketplace, event_id, fixture_id, manual, score) VALUES (?, ?, ?, ?, ?)`,
+		link.Marketplace, link.EventID, link.Fixture, link.Manual, link.Score)
+	if err != nil {
+		return err
+	}
+
+	r.links[[2]string{link.Marketplace, link.EventID}] = link
+	return nil
+}
+
+// add registers a new fixture, named after its teams and date unless f
+// already has an ID.
+func (r *fixtureRegistry) add(f *Fixture) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.addLocked(f)
+}
+
+func (r *fixtureRegistry) addLocked(f *Fixture) error {
+	if f.ID == "" {
+		base := fixtureSlug(f)
+		f.ID = base
+		for i := 2; r.fixtures[f.ID] != nil; i++ {
+			f.ID = fmt.Sprintf("%s-%d", base, i)
+		}
+	} else if r.fixtures[f.ID] != nil {
+		return fmt.Errorf("fixture %s already exists", f.ID)
+	}
+
+	return r.saveFixture(f)
+}
+
+// link sets w.Fixture to the fixture its marketplace event belongs to. An
+// existing link always wins, so links overridden through the API survive
+// restarts. Otherwise a fixture named on the watch is saved as a manual link,
+// then the closest known fixture is used, and failing that a new fixture is
+// made from the watch's title. Watches without a title or link are left
+// alone.
+func (r *fixtureRegistry) link(w *watch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{marketplaceOf(w.Source), w.EventID}
+	described, ok := newFixture(w.Title, w.Venue, w.Kickoff)
+
+	if link, found := r.links[key]; found {
+		if w.Fixture != "" && w.Fixture != link.Fixture {
+			slog.Info("Keeping existing fixture link", "source", w.Source, "event", w.EventID, "fixture", link.Fixture, "named", w.Fixture)
+		}
+		w.Fixture = link.Fixture
+		return nil
+	}
+
+	if w.Fixture != "" {
+		if r.fixtures[w.Fixture] == nil {
+			f := &Fixture{ID: w.Fixture, Title: w.Fixture}
+			if ok {
+				described.ID = w.Fixture
+				f = described
+			}
+			if err := r.saveFixture(f); err != nil {
+				return err
+			}
+		}
+
+		return r.saveLink(EventLink{Marketplace: key[0], EventID: key[1], Fixture: w.Fixture, Manual: true})
+	}
+
+	if !ok {
+		return nil
+	}
+
+	best, bestScore := "", 0.0
+	for id, f := range r.fixtures {
+		if score := matchScore(described, f); score > bestScore {
+			best, bestScore = id, score
+		}
+	}
+
+	if bestScore < fixtureMatchScore {
+		if err := r.addLocked(described); err != nil {
+			return err
+		}
+		best, bestScore = described.ID, 1
+	} else {
+		slog.Info("Matched event to fixture", "source", w.Source, "event", w.EventID, "fixture", best, "score", bestScore)
+	}
+
+	w.Fixture = best
+	return r.saveLink(EventLink{Marketplace: key[0], EventID: key[1], Fixture: best, Score: bestScore})
+}
+
+// override links a marketplace event to a fixture by hand.
+func (r *fixtureRegistry) override(marketplace, eventID, fixtureID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fixtures[fixtureID] == nil {
+		return fmt.Errorf("unknown fixture %s", fixtureID)
+	}
+
+	return r.saveLink(EventLink{Marketplace: marketplace, EventID: eventID, Fixture: fixtureID, Manual: true})
+}
+
+func (r *fixtureRegistry) get(id string) (Fixture, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.fixtures[id]
+	if !ok {
+		return Fixture{}, false
+	}
+	return *f, true
+}
+
+// fixtureOf returns the fixture a marketplace event is linked to.
+func (r *fixtureRegistry) fixtureOf(marketplace, eventID string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link, ok := r.links[[2]string{marketplace, eventID}]
+	return link.Fixture, ok
+}
+
+func (r *fixtureRegistry) list() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Fixture, 0, len(r.fixtures))
+	for _, f := range r.fixtures {
+		list = append(list, *f)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// events returns the links of a fixture, sorted by marketplace.
+func (r *fixtureRegistry) events(fixtureID string) []EventLink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	links := make([]EventLink, 0)
+	for _, link := range r.links {
+		if link.Fixture == fixtureID {
+			links = append(links, link)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Marketplace != links[j].Marketplace {
+			return links[i].Marketplace < links[j].Marketplace
+		}
+		return links[i].EventID < links[j].EventID
+	})
+
+	return links
+}
+
+// fixtureFeeds returns the source and event ID of every feed of a fixture's
+// linked events.
+func fixtureFeeds(fixtureID string) [][2]string {
+	feeds := make([][2]string, 0)
+	for _, link := range fixtures.events(fixtureID) {
+		sources, ok := marketplaceSources[link.Marketplace]
+		if !ok {
+			sources = []string{link.Marketplace}
+		}
+
+		for _, source := range sources {
+			feeds = append(feeds, [2]string{source, link.EventID})
+		}
+	}
+
+	return feeds
+}
+
+// fixtureCondition is a SQL condition on source and event_id matching the
+// listings of every event linked to a fixture.
+func fixtureCondition(fixtureID string) (string, []interface{}) {
+	return feedCondition(fixtureFeeds(fixtureID))
+}
+
+// feedCondition is a SQL condition matching any of the given source and
+// event ID pairs.
+func feedCondition(feeds [][2]string) (string, []interface{}) {
+	conditions := make([]string, 0, len(feeds))
+	args := make([]interface{}, 0, 2*len(feeds))
+	for _, feed := range feeds {
+		conditions = append(conditions, "(source = ? AND event_id = ?)")
+		args = append(args, feed[0], feed[1])
+	}
+
+	if len(conditions) == 0 {
+		return "0 = 1", args
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// relink points every watch of a marketplace event at the fixture the event
+// is now linked to.
+func relink(marketplace, eventID, fixtureID string) {
+	for _, w := range registry.list() {
+		if marketplaceOf(w.Source) != marketplace || w.EventID != eventID {
+			continue
+		}
+
+		registry.update(w.ID, func(w *watch) error {
+			w.Fixture = fixtureID
+			return nil
+		})
+	}
+}
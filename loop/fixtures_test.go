@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestLinkKeepsOverride checks a preset watch naming a fixture doesn't undo
+// a link made through the API when it's linked again on restart.
+func TestLinkKeepsOverride(t *testing.T) {
+	if err := openDB(filepath.Join(t.TempDir(), "watcher.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r := &fixtureRegistry{fixtures: make(map[string]*Fixture), links: make(map[[2]string]EventLink)}
+
+	preset := watch{Source: "viagogo", EventID: "153572300", Fixture: "bears-jaguars"}
+	w := preset
+	if err := r.link(&w); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.saveFixture(&Fixture{ID: "bears-jaguars-wembley", Title: "Bears vs Jaguars"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.override("viagogo", "153572300", "bears-jaguars-wembley"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &fixtureRegistry{fixtures: make(map[string]*Fixture), links: make(map[[2]string]EventLink)}
+	if err := restarted.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	w = preset
+	if err := restarted.link(&w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Fixture != "bears-jaguars-wembley" {
+		t.Errorf("watch linked to %q, want the override", w.Fixture)
+	}
+	if fixture, _ := restarted.fixtureOf("viagogo", "153572300"); fixture != "bears-jaguars-wembley" {
+		t.Errorf("event linked to %q, want the override", fixture)
+	}
+}
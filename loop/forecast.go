@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// forecastRefit is how long a fitted model is used before it's fitted
+	// again on the latest history.
+	forecastRefit = 6 * time.Hour
+	// forecastRetry is how long a fit that failed is kept before trying
+	// again.
+	forecastRetry = 10 * time.Minute
+	// forecastMinFixtures and forecastMinSamples are the least history a
+	// model is fitted from.
+	forecastMinFixtures = 2
+	forecastMinSamples  = 30
+	// forecastSampleEvery keeps one snapshot per feed per interval, so busy
+	// hours don't outweigh quiet ones.
+	forecastSampleEvery = time.Hour
+)
+
+// Forecast is the lowest price an event's listings are expected to reach
+// before kickoff.
+type Forecast struct {
+	Fixture        string  `json:"fixture"`
+	Opponent       string  `json:"opponent,omitempty"`
+	Currency       string  `json:"currency"`
+	HoursToKickoff float64 `json:"hoursToKickoff"`
+	Listings       int     `json:"listings"`
+	Current        float64 `json:"current"`
+	Floor          float64 `json:"floor"`
+	// Fixtures and Samples are how much history the model was fitted on.
+	Fixtures int `json:"fixtures"`
+	Samples  int `json:"samples"`
+}
+
+// forecastModel predicts how far below the current cheapest listing prices
+// will still fall, as the log of the ratio, from the hours left to kickoff
+// and the number of listings up. Each opponent gets an offset on top, shrunk
+// towards zero when there are few games against them.
+type forecastModel struct {
+	coef      [3]float64
+	opponents map[string]float64
+	fixtures  int
+	samples   int
+}
+
+type forecastSample struct {
+	features [3]float64
+	drop     float64
+}
+
+type forecaster struct {
+	mu       sync.Mutex
+	model    *forecastModel
+	err      error
+	fittedAt time.Time
+	fitting  bool
+}
+
+var (
+	forecasts = &forecaster{}
+)
+
+func forecastFeatures(hours float64, listings int) [3]float64 {
+	return [3]float64{1, math.Log1p(max(hours, 0)), math.Log1p(float64(listings))}
+}
+
+func (m *forecastModel) predict(features [3]float64, opponent string) float64 {
+	drop := m.opponents[opponent]
+	for i, x := range features {
+		drop += m.coef[i] * x
+	}
+	return drop
+}
+
+// opponent is the team in a fixture that isn't the one we follow, taken to
+// be whichever of the two plays in fewer of the known fixtures. Teams are
+// keyed by teamKey, as fixture matching sees them.
+func opponent(f Fixture, all []Fixture) string {
+	games := make(map[string]int)
+	for _, other := range all {
+		games[teamKey(other.HomeTeam)]++
+		games[teamKey(other.AwayTeam)]++
+	}
+
+	if games[teamKey(f.HomeTeam)] < games[teamKey(f.AwayTeam)] {
+		return teamKey(f.HomeTeam)
+	}
+	return teamKey(f.AwayTeam)
+}
+
+// forecastSamples turns a past fixture's snapshots into samples: at each
+// snapshot, how far the cheapest listing still fell before kickoff.
+func forecastSamples(f Fixture) ([]forecastSample, error) {
+	snapshots, err := getSnapshots(observationFilter{Fixture: f.ID, Until: *f.Kickoff})
+	if err != nil {
+		return nil, err
+	}
+
+	type point struct {
+		at       time.Time
+		listings int
+		min      float64
+	}
+
+	feeds := make(map[[3]string][]point)
+	for _, s := range snapshots {
+		cheapest := make(map[string]float64)
+		listings := make(map[string]int)
+		for _, t := range s.tickets {
+			currency := currencyOf(t)
+			if price, ok := cheapest[currency]; !ok || t.Price < price {
+				cheapest[currency] = t.Price
+			}
+			listings[currency]++
+		}
+
+		for currency, price := range cheapest {
+			feed := [3]string{s.feed[0], s.feed[1], currency}
+			feeds[feed] = append(feeds[feed], point{at: s.at, listings: listings[currency], min: price})
+		}
+	}
+
+	samples := make([]forecastSample, 0)
+	for _, points := range feeds {
+		// Walk back from kickoff so the lowest price still to come is
+		// known at every point.
+		floor := math.Inf(1)
+		var last time.Time
+		for i := len(points) - 1; i >= 0; i-- {
+			p := points[i]
+			floor = min(floor, p.min)
+
+			bucket := p.at.Truncate(forecastSampleEvery)
+			if bucket.Equal(last) {
+				continue
+			}
+			last = bucket
+
+			samples = append(samples, forecastSample{
+				features: forecastFeatures(f.Kickoff.Sub(p.at).Hours(), p.listings),
+				drop:     math.Log(floor / p.min),
+			})
+		}
+	}
+
+	return samples, nil
+}
+
+// fitForecast fits a model on every fixture that has kicked off.
+func fitForecast(now time.Time) (*forecastModel, error) {
+	all := fixtures.list()
+
+	var samples []forecastSample
+	byOpponent := make(map[string][][]forecastSample)
+	fitted := 0
+	for _, f := range all {
+		if f.Kickoff == nil || f.Kickoff.After(now) {
+			continue
+		}
+
+		fixtureSamples, err := forecastSamples(f)
+		if err != nil {
+			return nil, err
+		}
+		if len(fixtureSamples) == 0 {
+			continue
+		}
+
+		fitted++
+		samples = append(samples, fixtureSamples...)
+		byOpponent[opponent(f, all)] = append(byOpponent[opponent(f, all)], fixtureSamples)
+	}
+
+	if fitted < forecastMinFixtures || len(samples) < forecastMinSamples {
+		return nil, fmt.Errorf("%d past fixtures and %d samples is too little history", fitted, len(samples))
+	}
+
+	m := &forecastModel{opponents: make(map[string]float64), fixtures: fitted, samples: len(samples)}
+	m.coef = leastSquares(samples)
+
+	// An opponent's offset is the mean of its games' mean residuals, shrunk
+	// as if there were one more game against them with no residual.
+	for name, games := range byOpponent {
+		total := 0.0
+		for _, game := range games {
+			residual := 0.0
+			for _, s := range game {
+				residual += s.drop - m.predict(s.features, "")
+			}
+			total += residual / float64(len(game))
+		}
+		m.opponents[name] = total / float64(len(games)+1)
+	}
+
+	return m, nil
+}
+
+// leastSquares solves the normal equations of a linear fit of drop on the
+// features, with a little ridge to keep them solvable.
+func leastSquares(samples []forecastSample) [3]float64 {
+	var a [3][4]float64
+	for _, s := range samples {
+		for i := range 3 {
+			for j := range 3 {
+				a[i][j] += s.features[i] * s.features[j]
+			}
+			a[i][3] += s.features[i] * s.drop
+		}
+	}
+	for i := range 3 {
+		a[i][i] += 1e-6
+	}
+
+	for col := range 3 {
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		for row := range 3 {
+			if row == col || a[col][col] == 0 {
+				continue
+			}
+			factor := a[row][col] / a[col][col]
+			for k := col; k < 4; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+
+	var coef [3]float64
+	for i := range 3 {
+		if a[i][i] != 0 {
+			coef[i] = a[i][3] / a[i][i]
+		}
+	}
+	return coef
+}
+
+// current returns the fitted model, fitting it again when it's old, or
+// sooner when the last fit failed. The fit runs without the lock held, and
+// callers that come in meanwhile get the model from before it.
+func (f *forecaster) current(now time.Time) (*forecastModel, error) {
+	f.mu.Lock()
+	refit := forecastRefit
+	if f.err != nil {
+		refit = forecastRetry
+	}
+	stale := f.fittedAt.IsZero() || now.Sub(f.fittedAt) >= refit || now.Before(f.fittedAt)
+	if !stale || f.fitting {
+		model, err := f.model, f.err
+		f.mu.Unlock()
+		if model == nil && err == nil {
+			err = fmt.Errorf("forecast model is still being fitted")
+		}
+		return model, err
+	}
+	f.fitting = true
+	f.mu.Unlock()
+
+	model, err := fitForecast(now)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.model, f.err, f.fittedAt, f.fitting = model, err, now, false
+	return model, err
+}
+
+// forecast predicts the floor of a watch's listings in the given currency.
+func (f *forecaster) forecast(w watch, tickets []Ticket, currency string, now time.Time) (*Forecast, error) {
+	fixture, known := fixtures.get(w.fixture())
+	kickoff := w.Kickoff
+	if known && fixture.Kickoff != nil {
+		kickoff = fixture.Kickoff
+	}
+	if kickoff == nil || !kickoff.After(now) {
+		return nil, fmt.Errorf("no upcoming kickoff for fixture %q", w.fixture())
+	}
+
+	forecast := &Forecast{
+		Fixture:        w.fixture(),
+		Currency:       currency,
+		HoursToKickoff: kickoff.Sub(now).Hours(),
+	}
+	for _, t := range tickets {
+		if currencyOf(t) != currency {
+			continue
+		}
+		if forecast.Listings == 0 || t.Price < forecast.Current {
+			forecast.Current = t.Price
+		}
+		forecast.Listings++
+	}
+	if forecast.Listings == 0 {
+		return nil, fmt.Errorf("no %s listings", currency)
+	}
+
+	model, err := f.current(now)
+	if err != nil {
+		return nil, err
+	}
+
+	if known {
+		forecast.Opponent = opponent(fixture, fixtures.list())
+	}
+	drop := model.predict(forecastFeatures(forecast.HoursToKickoff, forecast.Listings), forecast.Opponent)
+	// Prices can't be expected to end up above where they are now.
+	drop = min(drop, 0)
+	forecast.Floor = math.Round(forecast.Current*math.Exp(drop)*100) / 100
+	forecast.Fixtures, forecast.Samples = model.fixtures, model.samples
+
+	return forecast, nil
+}
+
+// forecastNote says whether an alerted listing is worth buying now or
+// waiting on, for the alert text. The floor is forecast from the other
+// listings, as t's own price would cap it at t.
+func forecastNote(ctx context.Context, w watch, t Ticket, tickets []Ticket, now time.Time) string {
+	others := make([]Ticket, 0, len(tickets))
+	for _, other := range tickets {
+		if other.Key() != t.Key() {
+			others = append(others, other)
+		}
+	}
+
+	forecast, err := forecasts.forecast(w, others, currencyOf(t), now)
+	if err != nil {
+		loggerFrom(ctx).Debug("No price forecast", "error", err)
+		return ""
+	}
+
+	if t.Price <= forecast.Floor {
+		return fmt.Sprintf("%.0f%% below the forecast floor (%s).", (1-t.Price/forecast.Floor)*100, formatPrice(forecast.Floor, t.Currency))
+	}
+	return fmt.Sprintf("Forecast floor before kickoff is %s, %.0f%% lower.", formatPrice(forecast.Floor, t.Currency), (1-forecast.Floor/t.Price)*100)
+}
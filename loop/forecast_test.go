@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestForecasterRetriesFailedFit(t *testing.T) {
+	f := &forecaster{}
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// With no fixtures there's too little history, so every fit fails.
+	if _, err := f.current(start); err == nil {
+		t.Fatal("expected the fit to fail without history")
+	}
+
+	f.current(start.Add(forecastRetry / 2))
+	if !f.fittedAt.Equal(start) {
+		t.Errorf("failed fit was retried after %s", forecastRetry/2)
+	}
+
+	f.current(start.Add(forecastRetry))
+	if !f.fittedAt.Equal(start.Add(forecastRetry)) {
+		t.Errorf("failed fit wasn't retried after %s", forecastRetry)
+	}
+}
+
+func TestForecasterDoesNotWaitOnFit(t *testing.T) {
+	model := &forecastModel{fixtures: 2, samples: 40}
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	f := &forecaster{model: model, fittedAt: start, fitting: true}
+
+	got, err := f.current(start.Add(2 * forecastRefit))
+	if err != nil || got != model {
+		t.Errorf("got %v, %v while a fit was running, want the previous model", got, err)
+	}
+}
+
+// TestOpponent checks teams are told apart the way fixture matching tells
+// them apart, so spelling a team two ways doesn't split its games.
+func TestOpponent(t *testing.T) {
+	f := Fixture{HomeTeam: "The Chicago Bears", AwayTeam: "Jacksonville Jaguars"}
+	all := []Fixture{
+		f,
+		{HomeTeam: "Chicago Bears", AwayTeam: "Green Bay Packers"},
+		{HomeTeam: "Jacksonville Jaguars", AwayTeam: "Chicago Bears FC"},
+	}
+
+	if got := opponent(f, all); got != "jacksonville jaguars" {
+		t.Errorf("got opponent %q, want jacksonville jaguars", got)
+	}
+}
+
+// TestForecastNote checks the floor an alerted listing is compared with is
+// forecast from the other listings, so a listing can be below it.
+func TestForecastNote(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	kickoff := now.Add(48 * time.Hour)
+	w := watch{ID: "viagogo-forecast-note", Source: "viagogo", Kickoff: &kickoff}
+
+	saved := forecasts
+	defer func() { forecasts = saved }()
+	forecasts = &forecaster{model: &forecastModel{coef: [3]float64{-0.1, 0, 0}}, fittedAt: now}
+
+	cheap := Ticket{Source: "viagogo", ID: "1", Price: 80, Currency: "GBP"}
+	tickets := []Ticket{
+		cheap,
+		{Source: "viagogo", ID: "2", Price: 100, Currency: "GBP"},
+		{Source: "viagogo", ID: "3", Price: 120, Currency: "GBP"},
+	}
+
+	want := "12% below the forecast floor (£90.48)."
+	if got := forecastNote(context.Background(), w, cheap, tickets, now); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultStaleAfterPolls = 6
+)
+
+var (
+	staleAfter           time.Duration
+	operatorPhoneNumbers []string
+	lastTick             atomic.Int64
+	operatorNotices      sync.WaitGroup
+)
+
+type healthReport struct {
+	Status  string       `json:"status"`
+	Reason  string       `json:"reason,omitempty"`
+	Watches []PollStatus `json:"watches"`
+}
+
+// loadHealthConfig reads STALE_AFTER_POLLS, the number of loop intervals a
+// watch may go without a successful parse, and OPERATOR_PHONE_NUMBERS, who
+// gets texted when a watch goes stale or recovers.
+func loadHealthConfig() error {
+	polls, err := strconv.Atoi(envOr("STALE_AFTER_POLLS", strconv.Itoa(defaultStaleAfterPolls)))
+	if err != nil || polls <= 0 {
+		return fmt.Errorf("invalid STALE_AFTER_POLLS")
+	}
+	staleAfter = time.Duration(polls) * loopTime
+
+	operatorPhoneNumbers = strings.Split(envOr("OPERATOR_PHONE_NUMBERS", ethanPhoneNumber), ",")
+
+	return nil
+}
+
+// updateStaleness flags watches whose last successful poll (or first attempt,
+// if none has succeeded) is older than staleAfter. It returns the watches
+// that changed state.
+func (s *watcherState) updateStaleness(now time.Time) []PollStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make([]PollStatus, 0)
+	for _, status := range s.polls {
+		since := status.LastSuccess
+		if since.IsZero() {
+			since = status.FirstPoll
+		}
+
+		stale := now.Sub(since) > staleAfter
+		if stale != status.Stale {
+			status.Stale = stale
+			changed = append(changed, *status)
+		}
+	}
+
+	return changed
+}
+
+func checkHealth(now time.Time) {
+	lastTick.Store(now.Unix())
+
+	for _, status := range watcher.updateStaleness(now) {
+		var msg string
+		if status.Stale {
+			msg = fmt.Sprintf("Watcher: %s has not parsed successfully since %s. Last error: %s", status.Watch, lastSuccessText(status), status.LastError)
+			slog.Warn("Watch went stale", "watch", status.Watch, "lastSuccess", status.LastSuccess, "error", status.LastError)
+		} else {
+			msg = fmt.Sprintf("Watcher: %s has recovered.", status.Watch)
+			slog.Info("Watch recovered", "watch", status.Watch)
+		}
+
+		notifyOperatorsLater(msg)
+	}
+}
+
+func lastSuccessText(status PollStatus) string {
+	if status.LastSuccess.IsZero() {
+		return "it started"
+	}
+	return status.LastSuccess.Format("Mon 15:04")
+}
+
+// notifyOperatorsLater texts operators without holding up the poll.
+func notifyOperatorsLater(msg string) {
+	operatorNotices.Add(1)
+	go func() {
+		defer operatorNotices.Done()
+		notifyOperators(msg)
+	}()
+}
+
+func notifyOperators(msg string) {
+	for _, phoneNumber := range operatorPhoneNumbers {
+		err := sendMessage(context.Background(), msg, phoneNumber)
+		alertsSent.WithLabelValues("sms-operator", outcome(err)).Inc()
+		if err != nil {
+			slog.Error("Error notifying operator", "to", phoneNumber, "error", err)
+		}
+	}
+}
+
+// handleHealthz fails when the loop has stopped ticking or every watch is
+// stale, i.e. when restarting the watcher is the only thing left to try.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: "ok", Watches: watcher.getPolls()}
+
+	tick := lastTick.Load()
+	if tick != 0 && time.Since(time.Unix(tick, 0)) > 3*loopTime {
+		report.Status = "unhealthy"
+		report.Reason = "loop has stopped ticking"
+	}
+
+	stale := 0
+	for _, status := range report.Watches {
+		if status.Stale {
+			stale++
+		}
+	}
+
+	if len(report.Watches) > 0 && stale == len(report.Watches) {
+		report.Status = "unhealthy"
+		report.Reason = "every watch is stale"
+	}
+
+	writeHealthReport(w, report)
+}
+
+// handleReadyz fails as soon as any watch is stale.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: "ok", Watches: watcher.getPolls()}
+
+	for _, status := range report.Watches {
+		if status.Stale {
+			report.Status = "unhealthy"
+			report.Reason = status.Watch + " is stale"
+			break
+		}
+	}
+
+	writeHealthReport(w, report)
+}
+
+func writeHealthReport(w http.ResponseWriter, report healthReport) {
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultDBPath = "watcher.db"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS observations (
+	observed_at INTEGER NOT NULL,
+	source      TEXT NOT NULL,
+	event_id    TEXT NOT NULL,
+	listing_id  TEXT NOT NULL,
+	section     TEXT NOT NULL,
+	row         TEXT NOT NULL,
+	price       REAL NOT NULL,
+	score       REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS observations_section ON observations (source, event_id, section, observed_at);
+
+CREATE TABLE IF NOT EXISTS alerts (
+	sent_at      INTEGER NOT NULL,
+	source       TEXT NOT NULL,
+	event_id     TEXT NOT NULL,
+	listing_id   TEXT NOT NULL,
+	section      TEXT NOT NULL,
+	row          TEXT NOT NULL,
+	price        REAL NOT NULL,
+	phone_number TEXT NOT NULL,
+	error        TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS fetches (
+	fetched_at INTEGER NOT NULL,
+	poll_id    TEXT NOT NULL,
+	watch_id   TEXT NOT NULL,
+	source     TEXT NOT NULL,
+	event_id   TEXT NOT NULL,
+	method     TEXT NOT NULL,
+	url        TEXT NOT NULL,
+	status     INTEGER NOT NULL,
+	header     TEXT NOT NULL,
+	hash       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fetches_fetched_at ON fetches (fetched_at);
+
+CREATE TABLE IF NOT EXISTS fixtures (
+	id        TEXT PRIMARY KEY,
+	title     TEXT NOT NULL,
+	home_team TEXT NOT NULL,
+	away_team TEXT NOT NULL,
+	venue     TEXT NOT NULL,
+	kickoff   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS event_links (
+	marketplace TEXT NOT NULL,
+	event_id    TEXT NOT NULL,
+	fixture_id  TEXT NOT NULL,
+	manual      INTEGER NOT NULL,
+	score       REAL NOT NULL,
+	PRIMARY KEY (marketplace, event_id)
+);
+
+CREATE TABLE IF NOT EXISTS sales (
+	sold_at    INTEGER NOT NULL,
+	source     TEXT NOT NULL,
+	event_id   TEXT NOT NULL,
+	listing_id TEXT NOT NULL,
+	section    TEXT NOT NULL,
+	row        TEXT NOT NULL,
+	price      REAL NOT NULL,
+	currency   TEXT NOT NULL,
+	evidence   TEXT NOT NULL,
+	PRIMARY KEY (source, event_id, listing_id)
+);
+CREATE INDEX IF NOT EXISTS sales_sold_at ON sales (sold_at);
+
+CREATE TABLE IF NOT EXISTS listing_states (
+	source        TEXT NOT NULL,
+	event_id      TEXT NOT NULL,
+	listing_id    TEXT NOT NULL,
+	section       TEXT NOT NULL,
+	row           TEXT NOT NULL,
+	price         REAL NOT NULL,
+	link          TEXT NOT NULL,
+	currency      TEXT NOT NULL,
+	alerted_at    INTEGER NOT NULL,
+	acked         INTEGER NOT NULL,
+	blacklisted   INTEGER NOT NULL,
+	snoozed_until INTEGER NOT NULL,
+	PRIMARY KEY (source, listing_id)
+);
+`
+
+type Alert struct {
+	SentAt      time.Time `json:"sentAt"`
+	Ticket      Ticket    `json:"ticket"`
+	PhoneNumber string    `json:"phoneNumber"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type PricePoint struct {
+	At    time.Time `json:"at"`
+	Price float64   `json:"price"`
+}
+
+type Observation struct {
+	ObservedAt time.Time `json:"observedAt"`
+	Ticket     Ticket    `json:"ticket"`
+}
+
+// observationFilter narrows down getObservations. Empty fields match
+// everything.
+type observationFilter struct {
+	Source    string
+	EventID   string
+	Section   string
+	ListingID string
+	// Fixture matches every marketplace event linked to it.
+	Fixture string
+	// Feeds, if any, are the only source and event ID pairs matched.
+	Feeds [][2]string
+	Since time.Time
+	Until time.Time
+	Limit int
+	// Empty also matches the rows marking polls that left a feed with no
+	// listings. They come back as observations with no listing ID.
+	Empty bool
+}
+
+var (
+	db *sql.DB
+)
+
+func openDB(path string) error {
+	d, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+
+	// SQLite only allows one writer and every watch writes from its own
+	// goroutine, so queue everything on a single connection.
+	d.SetMaxOpenConns(1)
+
+	if _, err := d.Exec(schema); err != nil {
+		d.Close()
+		return err
+	}
+
+	if err := migrate(d); err != nil {
+		d.Close()
+		return err
+	}
+
+	db = d
+	return nil
+}
+
+// columns added to tables after they were first created. CREATE TABLE IF NOT
+// EXISTS leaves older databases without them.
+var columns = []struct {
+	table, column, definition string
+}{
+	{"observations", "currency", "TEXT NOT NULL DEFAULT ''"},
+}
+
+func migrate(d *sql.DB) error {
+	for _, c := range columns {
+		var count int
+		err := d.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		if _, err := d.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordSnapshot stores every listing of a poll. It is only called when the
+// listings changed since the previous poll, so history is a series of
+// snapshots that hold until the next one. Feeds left with no listings get a
+// row with an empty listing ID instead, so their last listings don't hold
+// forever.
+func recordSnapshot(tickets []Ticket, emptied [][2]string, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO observations (observed_at, source, event_id, listing_id, section, row, price, score, currency) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range tickets {
+		if _, err := stmt.Exec(now.Unix(), t.Source, t.EventID, t.ID, t.Section, t.Row, t.Price, t.Score, t.Currency); err != nil {
+			return err
+		}
+	}
+
+	for _, feed := range emptied {
+		if _, err := stmt.Exec(now.Unix(), feed[0], feed[1], "", "", "", 0, 0, ""); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// emptiedFeeds returns the source and event pairs that had listings before a
+// poll and have none after it.
+func emptiedFeeds(changes []ListingChange, tickets []Ticket) [][2]string {
+	live := make(map[[2]string]bool)
+	for _, t := range tickets {
+		live[[2]string{t.Source, t.EventID}] = true
+	}
+
+	emptied := make([][2]string, 0)
+	for _, c := range changes {
+		feed := [2]string{c.Ticket.Source, c.Ticket.EventID}
+		if c.Type == changeSold && !live[feed] {
+			live[feed] = true
+			emptied = append(emptied, feed)
+		}
+	}
+
+	return emptied
+}
+
+func recordAlert(ticket Ticket, phoneNumber string, sendErr error, now time.Time) error {
+	errorMessage := ""
+	if sendErr != nil {
+		errorMessage = sendErr.Error()
+	}
+
+	_, err := db.Exec(`INSERT INTO alerts (sent_at, source, event_id, listing_id, section, row, price, phone_number, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		now.Unix(), ticket.Source, ticket.EventID, ticket.ID, ticket.Section, ticket.Row, ticket.Price, phoneNumber, errorMessage)
+
+	return err
+}
+
+// getRecentAlerts returns the latest alerts, only those for the given fixture
+// if it isn't empty.
+func getRecentAlerts(fixture string, limit int) ([]Alert, error) {
+	condition, args := "1 = 1", make([]interface{}, 0)
+	if fixture != "" {
+		condition, args = fixtureCondition(fixture)
+	}
+
+	return queryAlerts(`SELECT sent_at, source, event_id, listing_id, section, row, price, phone_number, error FROM alerts WHERE `+condition+` ORDER BY sent_at DESC LIMIT ?`, append(args, limit)...)
+}
+
+// getAlerts returns the alerts matching a filter, oldest first.
+func getAlerts(filter observationFilter) ([]Alert, error) {
+	condition, args := filterCondition(filter, "sent_at")
+	query := `SELECT sent_at, source, event_id, listing_id, section, row, price, phone_number, error FROM alerts WHERE ` + condition + ` ORDER BY sent_at`
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return queryAlerts(query, args...)
+}
+
+func queryAlerts(query string, args ...interface{}) ([]Alert, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]Alert, 0)
+	for rows.Next() {
+		var alert Alert
+		var sentAt int64
+		t := &alert.Ticket
+		if err := rows.Scan(&sentAt, &t.Source, &t.EventID, &t.ID, &t.Section, &t.Row, &t.Price, &alert.PhoneNumber, &alert.Error); err != nil {
+			return nil, err
+		}
+
+		alert.SentAt = time.Unix(sentAt, 0)
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// getSectionHistory returns the cheapest price in a section at each stored
+// snapshot since the given time.
+func getSectionHistory(source, eventID, section string, since time.Time) ([]PricePoint, error) {
+	rows, err := db.Query(`SELECT observed_at, MIN(price) FROM observations WHERE source = ? AND event_id = ? AND section = ? AND listing_id != '' AND observed_at >= ? GROUP BY observed_at ORDER BY observed_at`,
+		source, eventID, section, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]PricePoint, 0)
+	for rows.Next() {
+		var point PricePoint
+		var observedAt int64
+		if err := rows.Scan(&observedAt, &point.Price); err != nil {
+			return nil, err
+		}
+
+		point.At = time.Unix(observedAt, 0)
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+func getObservations(filter observationFilter) ([]Observation, error) {
+	condition, args := filterCondition(filter, "observed_at")
+	if !filter.Empty {
+		condition += " AND listing_id != ''"
+	}
+	query := `SELECT observed_at, source, event_id, listing_id, section, row, price, score, currency FROM observations WHERE ` + condition + ` ORDER BY observed_at`
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	observations := make([]Observation, 0)
+	for rows.Next() {
+		var observation Observation
+		var observedAt int64
+		t := &observation.Ticket
+		if err := rows.Scan(&observedAt, &t.Source, &t.EventID, &t.ID, &t.Section, &t.Row, &t.Price, &t.Score, &t.Currency); err != nil {
+			return nil, err
+		}
+
+		observation.ObservedAt = time.Unix(observedAt, 0)
+		observations = append(observations, observation)
+	}
+
+	return observations, rows.Err()
+}
+
+// filterCondition is a SQL condition matching the rows of a filter, with
+// timeColumn compared against Since and Until.
+func filterCondition(filter observationFilter, timeColumn string) (string, []interface{}) {
+	condition := "1 = 1"
+	args := make([]interface{}, 0)
+
+	for _, c := range [][2]string{
+		{"source", filter.Source},
+		{"event_id", filter.EventID},
+		{"section", filter.Section},
+		{"listing_id", filter.ListingID},
+	} {
+		if c[1] != "" {
+			condition += " AND " + c[0] + " = ?"
+			args = append(args, c[1])
+		}
+	}
+
+	if filter.Fixture != "" {
+		fixture, fixtureArgs := fixtureCondition(filter.Fixture)
+		condition += " AND " + fixture
+		args = append(args, fixtureArgs...)
+	}
+
+	if len(filter.Feeds) > 0 {
+		feeds, feedArgs := feedCondition(filter.Feeds)
+		condition += " AND " + feeds
+		args = append(args, feedArgs...)
+	}
+
+	if !filter.Since.IsZero() {
+		condition += " AND " + timeColumn + " >= ?"
+		args = append(args, filter.Since.Unix())
+	}
+
+	if !filter.Until.IsZero() {
+		condition += " AND " + timeColumn + " < ?"
+		args = append(args, filter.Until.Unix())
+	}
+
+	return condition, args
+}
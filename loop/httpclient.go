@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	defaultHttpTimeout = 30 * time.Second
+	userAgent          = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+)
+
+type marketplaceKey struct{}
+
+var (
+	// httpClient is shared by every source so connections and cookies
+	// survive between polls.
+	httpClient = newHttpClient(defaultHttpTimeout)
+
+	// headerProfiles are the headers sent to each marketplace. Entries in
+	// the HEADER_PROFILES file replace headers here one by one.
+	headerProfiles = map[string]http.Header{
+		"viagogo": {
+			"User-Agent":      {userAgent},
+			"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"},
+			"Accept-Language": {"en-GB,en;q=0.9"},
+			"Cache-Control":   {"no-cache"},
+			"Pragma":          {"no-cache"},
+		},
+		"stubhub": {
+			"User-Agent":      {userAgent},
+			"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"},
+			"Accept-Language": {"en-US,en;q=0.9"},
+			"Cache-Control":   {"no-cache"},
+			"Pragma":          {"no-cache"},
+		},
+		"twickets": {
+			"User-Agent":      {userAgent},
+			"Accept":          {"application/json, text/plain, */*"},
+			"Accept-Language": {"en-GB,en;q=0.9"},
+			"Cache-Control":   {"no-cache"},
+			"DNT":             {"1"},
+		},
+		"seatgeek": {
+			"User-Agent":      {userAgent},
+			"Accept":          {"application/json, text/plain, */*"},
+			"Accept-Language": {"en-US,en;q=0.9"},
+			"Cache-Control":   {"no-cache"},
+		},
+		"axs": {
+			"User-Agent":      {userAgent},
+			"Accept":          {"application/json, text/plain, */*"},
+			"Accept-Language": {"en-GB,en;q=0.9"},
+			"Cache-Control":   {"no-cache"},
+		},
+	}
+)
+
+func newHttpClient(timeout time.Duration) *http.Client {
+	jar, _ := cookiejar.New(nil)
+
+	transport := &http.Transport{
+		Proxy: proxyFor,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		// We ask for brotli as well, so decoding is done by
+		// decodingTransport rather than the transport's gzip-only handling.
+		DisableCompression: true,
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Jar:     jar,
+		Transport: &decodingTransport{
+			next: &proxyTransport{next: transport},
+		},
+	}
+}
+
+// loadHttpConfig reads HTTP_TIMEOUT, PROXIES, RATE_LIMITS and
+// HEADER_PROFILES, a JSON file mapping marketplace names to the headers to
+// send them.
+func loadHttpConfig() error {
+	if value := os.Getenv("HTTP_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid HTTP_TIMEOUT %q", value)
+		}
+		httpClient = newHttpClient(timeout)
+	}
+
+	if err := loadProxies(os.Getenv("PROXIES")); err != nil {
+		return err
+	}
+
+	if err := loadRateLimits(os.Getenv("RATE_LIMITS")); err != nil {
+		return err
+	}
+
+	path := os.Getenv("HEADER_PROFILES")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var profiles map[string]map[string]string
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return fmt.Errorf("invalid HEADER_PROFILES: %v", err)
+	}
+
+	for marketplace, headers := range profiles {
+		profile, ok := headerProfiles[marketplace]
+		if !ok {
+			profile = http.Header{}
+			headerProfiles[marketplace] = profile
+		}
+
+		for key, value := range headers {
+			profile.Set(key, value)
+		}
+	}
+
+	return nil
+}
+
+// newRequest builds a request carrying the header profile of a marketplace.
+// Only these requests go through the proxy pool and, sent with doRequest,
+// the rate limits.
+func newRequest(ctx context.Context, marketplace, method, url string, body io.Reader) (*http.Request, error) {
+	ctx = context.WithValue(ctx, marketplaceKey{}, marketplace)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range headerProfiles[marketplace] {
+		req.Header[key] = values
+	}
+
+	return req, nil
+}
+
+// decodingTransport advertises gzip, deflate and brotli and decodes the
+// response body, so callers always read plain bytes.
+type decodingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *decodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || req.Method == "HEAD" {
+		return resp, nil
+	}
+
+	body, err := decodeBody(encoding, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("decoding %s response: %v", encoding, err)
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return resp, nil
+}
+
+func decodeBody(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decodedBody{Reader: reader, closers: []io.Closer{reader, body}}, nil
+	case "deflate":
+		// Servers disagree on whether deflate means zlib-wrapped or raw.
+		buffered := bufio.NewReader(body)
+		header, _ := buffered.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			reader, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, err
+			}
+			return &decodedBody{Reader: reader, closers: []io.Closer{reader, body}}, nil
+		}
+		reader := flate.NewReader(buffered)
+		return &decodedBody{Reader: reader, closers: []io.Closer{reader, body}}, nil
+	case "br":
+		return &decodedBody{Reader: brotli.NewReader(body), closers: []io.Closer{body}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding")
+	}
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for _, closer := range b.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type loggerKey struct{}
+
+type pollIDKey struct{}
+
+var (
+	captureDir string
+)
+
+// setupLogging configures the default slog logger from LOG_FORMAT (text or
+// json) and LOG_LEVEL (debug, info, warn or error). Raw pages only get
+// captured when DEBUG_CAPTURE_DIR is set.
+func setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envOr("LOG_LEVEL", "info"))); err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL: %v", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format := envOr("LOG_FORMAT", "text"); format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	captureDir = os.Getenv("DEBUG_CAPTURE_DIR")
+	if captureDir != "" {
+		if err := os.MkdirAll(captureDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func newPollID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the poll's logger, which carries the watch, source,
+// event and poll ID.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// capturePage writes a raw page or API response to DEBUG_CAPTURE_DIR so it
+// can be inspected without flooding the logs.
+func capturePage(ctx context.Context, source, ext string, body []byte) {
+	if captureDir == "" {
+		return
+	}
+
+	logger := loggerFrom(ctx)
+	name := fmt.Sprintf("%s-%s-%s.%s", time.Now().Format("20060102-150405"), source, pollIDFrom(ctx), ext)
+	path := filepath.Join(captureDir, strings.ReplaceAll(name, "/", "_"))
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		logger.Warn("Could not capture page", "error", err)
+		return
+	}
+
+	logger.Debug("Captured page", "path", path, "bytes", len(body))
+}
+
+func withPollID(ctx context.Context, pollID string) context.Context {
+	return context.WithValue(ctx, pollIDKey{}, pollID)
+}
+
+func pollIDFrom(ctx context.Context) string {
+	if pollID, ok := ctx.Value(pollIDKey{}).(string); ok {
+		return pollID
+	}
+	return "none"
+}
@@ -1,403 +1,364 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"regexp"
-	"strconv"
+	"strings"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// "fmt"
-// "regexp"
-// "strings"
+type Ticket struct {
+	Source  string  `json:"source"`
+	EventID string  `json:"eventId"`
+	ID      string  `json:"id"`
+	Price   float64 `json:"price"`
+	// Fees is the part of Price that goes to the marketplace, when the
+	// source breaks it out. Price is always all-in.
+	Fees    float64 `json:"fees,omitempty"`
+	Row     string  `json:"row"`
+	Section string  `json:"section"`
+	// Seats is the seat numbers, e.g. "12-13", when the source gives them.
+	Seats string `json:"seats,omitempty"`
+	// Quantity is how many tickets the listing sells together, when the
+	// source says.
+	Quantity int     `json:"quantity,omitempty"`
+	Score    float64 `json:"score,omitempty"`
+	Link     string  `json:"link"`
+	// Currency is an ISO 4217 code. Empty means GBP.
+	Currency string `json:"currency,omitempty"`
+	// Sold marks a listing the marketplace shows as already sold, SoldAgo
+	// before the poll. Polls record these as sales and drop them.
+	Sold    bool          `json:"-"`
+	SoldAgo time.Duration `json:"-"`
+	// Origin is the source that fetched the listing when Source stands for
+	// more than one, as twickets does for the API and its browser fallback.
+	Origin string `json:"-"`
+}
 
-// "github.com/go-rod/rod"
+func (t Ticket) Key() string {
+	return t.Source + ":" + t.ID
+}
 
-// type Ticket struct {
-// 	Price   string `json:"price"`
-// 	Row     string `json:"row"`
-// 	Section string `json:"section"`
-// }
+// origin is the source the listing's ID was made up by.
+func (t Ticket) origin() string {
+	if t.Origin != "" {
+		return t.Origin
+	}
+	return t.Source
+}
+
+// Source is a marketplace we can poll for the current listings of an event.
+type Source interface {
+	Name() string
+	GetTickets(ctx context.Context) ([]Ticket, error)
+}
 
-// func main() {
-// 	browser := rod.New().MustConnect()
+const (
+	loopTime         = 10 * time.Second
+	defaultAddr      = ":8080"
+	ethanPhoneNumber = "+447476133726"
+	dadPhoneNumber   = "+447725841566"
+)
+
+func main() {
+	sources := flag.String("sources", "viagogo,twickets", "comma separated preset watches to start with ("+strings.Join(presetNames(), ", ")+"); watches on other marketplaces are added through the API")
+	flag.Parse()
 
-// 	page := browser.MustPage("https://www.viagogo.com/ww/Sports-Tickets/NFL/NFL-Matchups/Bears-vs-Jaguars/E-153572300?quantity=2&listingQty=&sections=&ticketClasses=&rows=&seats=&seatTypes=").MustWaitIdle()
-// 	page.MustWaitRequestIdle()
+	err := godotenv.Load()
+	if err != nil {
+		fatal("Error loading .env file", "error", err)
+	}
 
-// 	divs := page.MustElements(".sc-57jg3s-0.uNHdb")
+	if err := setupLogging(); err != nil {
+		fatal("Error setting up logging", "error", err)
+	}
 
-// 	tickets := []Ticket{}
+	for _, name := range strings.Split(*sources, ",") {
+		preset, ok := presetWatches[strings.TrimSpace(name)]
+		if !ok {
+			fatal("Unknown source", "source", name, "presets", presetNames())
+		}
 
-// 	for _, div := range divs {
-// 		text := div.MustText()
-// 		if strings.Contains(text, "Sold") {
-// 			continue
-// 		}
+		w, err := newWatch(preset)
+		if err != nil {
+			fatal("Error creating watch", "error", err)
+		}
 
-// 		re := regexp.MustCompile(`£\d+`)
-// 		price := re.FindString(text)
+		if err := registry.add(w); err != nil {
+			fatal("Error adding watch", "error", err)
+		}
+	}
 
-// 		reRow := regexp.MustCompile(`Row\s+(\d+)`)
-// 		row := reRow.FindStringSubmatch(text)
+	if err := loadHttpConfig(); err != nil {
+		fatal("Error loading HTTP config", "error", err)
+	}
 
-// 		reSection := regexp.MustCompile(`Section\s+(\d+)`)
-// 		section := reSection.FindStringSubmatch(text)
+	schemas.sampleDir = envOr("SCHEMA_SAMPLE_DIR", defaultSchemaSampleDir)
 
-// 		// Check if row was found
-// 		if len(row) <= 1 {
-// 			break
-// 		}
+	addr := envOr("HTTP_ADDR", defaultAddr)
+	if err := loadAckConfig(addr); err != nil {
+		fatal("Error loading ack config", "error", err)
+	}
 
-// 		// Check if section was found
-// 		if len(section) <= 1 {
-// 			break
-// 		}
+	if err := loadHealthConfig(); err != nil {
+		fatal("Error loading health config", "error", err)
+	}
 
-// 		ticket := Ticket{
-// 			Price:   price,
-// 			Row:     row[1],
-// 			Section: section[1],
-// 		}
+	if err := loadStoreConfig(); err != nil {
+		fatal("Error loading store config", "error", err)
+	}
 
-// 		tickets = append(tickets, ticket)
-// 	}
+	dbPath := envOr("DB_PATH", defaultDBPath)
 
-// 	cheapestTicket, err := getCheapestTicket(tickets)
-// 	if err != nil {
-// 		fmt.Println("Error:", err)
-// 	} else {
-// 		fmt.Printf("Cheapest ticket: %+v", cheapestTicket)
-// 	}
-// }
+	if err := openDB(dbPath); err != nil {
+		fatal("Error opening database", "path", dbPath, "error", err)
+	}
 
-// func getCheapestTicket(tickets []Ticket) (Ticket, error) {
-// 	cheapest := Ticket{
-// 		Price: "£999999",
-// 	}
+	if err := fixtures.load(); err != nil {
+		fatal("Error loading fixtures", "error", err)
+	}
 
-// 	for _, ticket := range tickets {
-// 		if ticket.Price < cheapest.Price {
-// 			cheapest = ticket
-// 		}
-// 	}
+	for _, w := range registry.list() {
+		if _, err := registry.update(w.ID, fixtures.link); err != nil {
+			fatal("Error linking watch to a fixture", "watch", w.ID, "error", err)
+		}
+	}
 
-// 	if cheapest.Price == "£999999" {
-// 		return cheapest, fmt.Errorf("No tickets found")
-// 	}
+	switch flag.Arg(0) {
+	case "replay":
+		runReplay(flag.Args()[1:])
+		return
+	case "stats":
+		runStats(flag.Args()[1:])
+		return
+	case "export":
+		runExport(flag.Args()[1:])
+		return
+	}
 
-// 	return cheapest, nil
-// }
+	if err := store.load(); err != nil {
+		fatal("Error loading listing states", "error", err)
+	}
 
-type AppData struct {
-	AppName string `json:"appName"`
-	Grid    Grid   `json:"grid"`
-}
+	if err := loadArchiveConfig(); err != nil {
+		fatal("Error loading archive config", "error", err)
+	}
+	if archiveRetention > 0 {
+		go pruneArchiveLoop()
+	}
 
-type Grid struct {
-	Items []Item `json:"items"`
+	go serve(addr)
+	logicLoop()
 }
 
-type Item struct {
-	ID                                  int64               `json:"id"`
-	ClientApplicationID                 int                 `json:"clientApplicationId"`
-	EventID                             int                 `json:"eventId"`
-	Section                             string              `json:"section"`
-	SectionID                           int                 `json:"sectionId"`
-	SectionMapName                      string              `json:"sectionMapName"`
-	SectionType                         int                 `json:"sectionType"`
-	Row                                 string              `json:"row"`
-	SeatFromInternal                    string              `json:"seatFromInternal"`
-	HasSeatDetails                      bool                `json:"hasSeatDetails"`
-	HasSeatDetailsUS                    bool                `json:"hasSeatDetailsUS"`
-	AvailableTickets                    int                 `json:"availableTickets"`
-	ListingPreviewPriceAndFeeDisclosure ValueDisclosure     `json:"listingPreviewPriceAndFeeDisclosure"`
-	SoldXTimeAgoSiteMessage             SoldMessage         `json:"soldXTimeAgoSiteMessage"`
-	ShowRecentlySold                    bool                `json:"showRecentlySold"`
-	AvailableQuantities                 []int               `json:"availableQuantities"`
-	TicketClass                         int                 `json:"ticketClass"`
-	TicketClassName                     string              `json:"ticketClassName"`
-	MaxQuantity                         int                 `json:"maxQuantity"`
-	HasListingNotes                     bool                `json:"hasListingNotes"`
-	ListingNotes                        []ListingNote       `json:"listingNotes"`
-	RowID                               int                 `json:"rowId"`
-	IsUsersListing                      bool                `json:"isUsersListing"`
-	IsPreUploaded                       bool                `json:"isPreUploaded"`
-	RowContent                          string              `json:"rowContent"`
-	RawPrice                            float64             `json:"rawPrice"`
-	Price                               string              `json:"price"`
-	TicketTypeID                        int                 `json:"ticketTypeId"`
-	TicketTypeGroupID                   int                 `json:"ticketTypeGroupId"`
-	ListingTypeID                       int                 `json:"listingTypeId"`
-	ListingCurrencyCode                 string              `json:"listingCurrencyCode"`
-	BuyerCurrencyCode                   string              `json:"buyerCurrencyCode"`
-	QualityRank                         int                 `json:"qualityRank"`
-	FaceValue                           float64             `json:"faceValue"`
-	FaceValueCurrencyCode               string              `json:"faceValueCurrencyCode"`
-	VfsURL                              string              `json:"vfsUrl"`
-	FormattedActiveSince                string              `json:"formattedActiveSince"`
-	IsSeatedTogether                    bool                `json:"isSeatedTogether"`
-	SellerUserID                        string              `json:"sellerUserId"`
-	ShowVfsInListing                    bool                `json:"showVfsInListing"`
-	HideSeatAndRowInfo                  bool                `json:"hideSeatAndRowInfo"`
-	SellerHideSeatInfo                  bool                `json:"sellerHideSeatInfo"`
-	AipHash                             string              `json:"aipHash"`
-	IsMLBVerified                       bool                `json:"isMLBVerified"`
-	IsStanding                          bool                `json:"isStanding"`
-	CreatedDateTime                     string              `json:"createdDateTime"`
-	IsHighestListingScore               bool                `json:"isHighestListingScore"`
-	IsMostAffordable                    bool                `json:"isMostAffordable"`
-	IsSponsored                         bool                `json:"isSponsored"`
-	IsCheapestListing                   bool                `json:"isCheapestListing"`
-	InventoryListingScore               *InventoryScore     `json:"inventoryListingScore,omitempty"`
-	TicketsRemainingMessage             *RemainingMessage   `json:"ticketsRemainingMessage,omitempty"`
-	BestSellingInSectionMessage         *BestSellingMessage `json:"bestSellingInSectionMessage,omitempty"`
+func serve(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", handleDashboard)
+	mux.HandleFunc("GET /history", handleHistory)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	mux.HandleFunc("GET /readyz", handleReadyz)
+	mux.HandleFunc("GET /l/{source}/{id}", handleListingPage)
+	mux.HandleFunc("POST /l/{source}/{id}", handleListingAction)
+	registerApi(mux)
+
+	slog.Info("Listening", "addr", addr)
+	fatal("HTTP server stopped", "error", http.ListenAndServe(addr, mux))
 }
 
-type ValueDisclosure struct {
-	HasValue bool `json:"hasValue"`
-}
+func logicLoop() {
+	ticker := time.NewTicker(loopTime)
 
-type SoldMessage struct {
-	Message            string `json:"message"`
-	Qualifier          string `json:"qualifier"`
-	HasValue           bool   `json:"hasValue"`
-	FeatureTrackingKey string `json:"featureTrackingKey"`
+	for {
+		select {
+		case now := <-ticker.C:
+			checkHealth(now)
+			for _, w := range registry.list() {
+				go logic(w)
+			}
+		}
+	}
 }
 
-type ListingNote struct {
-	ListingNoteID                   int    `json:"listingNoteId"`
-	ListingNoteContentID            int    `json:"listingNoteContentId"`
-	FormattedListingNoteContent     string `json:"formattedListingNoteContent"`
-	ListingNoteTypeID               int    `json:"listingNoteTypeId"`
-	ShowToBuyer                     bool   `json:"showToBuyer"`
-	HideInMock                      bool   `json:"hideInMock"`
-	SiteAddedListingNote            bool   `json:"siteAddedListingNote"`
-	AisleListingNoteWithSplit       bool   `json:"aisleListingNoteWithSplit"`
-	ListingNoteDescriptionContentID int    `json:"listingNoteDescriptionContentId"`
-	FormattedListingNoteDescription string `json:"formattedListingNoteDescription"`
-}
+func logic(w watch) {
+	if !watcher.beginPoll(w.ID) {
+		slog.Debug("Previous poll still running", "watch", w.ID)
+		return
+	}
+	defer watcher.endPoll(w.ID)
 
-type InventoryScore struct {
-	Discount         float64 `json:"discount"`
-	StarRating       float64 `json:"starRating"`
-	DealScore        float64 `json:"dealScore"`
-	SeatQualityScore float64 `json:"seatQualityScore"`
-}
+	ctx := pollContext(w, newPollID())
+	started := time.Now()
+	watcher.recordStart(w.ID, started)
 
-type RemainingMessage struct {
-	Message            string `json:"message"`
-	Qualifier          string `json:"qualifier"`
-	HasValue           bool   `json:"hasValue"`
-	FeatureTrackingKey string `json:"featureTrackingKey"`
-}
+	if !scheduler.shouldPoll(w, started) {
+		loggerFrom(ctx).Debug("Backing off")
+		return
+	}
 
-type BestSellingMessage struct {
-	Message            string `json:"message"`
-	Qualifier          string `json:"qualifier"`
-	Disclaimer         string `json:"disclaimer"`
-	HasValue           bool   `json:"hasValue"`
-	FeatureTrackingKey string `json:"featureTrackingKey"`
+	poll(ctx, w, started)
 }
 
-type Ticket struct {
-	ID      int64  `json:"id"`
-	Price   int    `json:"price"`
-	Row     string `json:"row"`
-	Section string `json:"section"`
+func pollContext(w watch, pollID string) context.Context {
+	logger := slog.With("watch", w.ID, "source", w.Source, "event", w.EventID, "poll", pollID)
+	return withWatch(withLogger(withPollID(context.Background(), pollID), logger), w)
 }
 
-var (
-	set = make(map[int64]bool)
-)
+// poll fetches a watch's listings, records them and alerts on the cheapest.
+// started is the time the poll counts as happening at, which replays set to
+// when it was archived.
+func poll(ctx context.Context, w watch, started time.Time) {
+	logger := loggerFrom(ctx)
 
-const (
-	maxPrice         = 100
-	ethanPhoneNumber = "+447476133726"
-	dadPhoneNumber   = "+447725841566"
-	url              = "https://www.viagogo.com/ww/Sports-Tickets/NFL/NFL-Matchups/Bears-vs-Jaguars/E-153572300?quantity=2&listingQty=&sections=&ticketClasses=&rows=&seats=&seatTypes="
-)
+	tickets, err := w.source.GetTickets(ctx)
+	tickets, sold := splitSold(tickets)
+	pollDuration.WithLabelValues(w.Source, outcome(err)).Observe(time.Since(started).Seconds())
 
-func main() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalln("Error loading .env file")
+	if _, ok := registry.get(w.ID); !ok {
+		logger.Info("Watch removed while polling, dropping the result")
+		return
 	}
 
-	logicLoop()
-}
-
-func logicLoop() {
-	ticker := time.NewTicker(10 * time.Second)
+	class := fetchClass(err)
+	if err == nil && len(tickets) == 0 {
+		class = fetchEmpty
+	}
+	fetchResults.WithLabelValues(w.Source, class).Inc()
 
-	for {
-		select {
-		case <-ticker.C:
-			go logic()
-		}
+	if scheduler.react(w, err, class, started) {
+		reactToClass(w, class, err)
 	}
-}
 
-func logic() {
-	cheapestTicket, err := getCheapestTicket()
 	if err != nil {
-		log.Println("Error:", err)
-	} else {
-		log.Printf("Cheapest ticket: %+v", cheapestTicket)
+		watcher.recordFailure(w.ID, err, started)
+		logger.Error("Poll failed", "error", err)
+		return
 	}
 
-	if cheapestTicket.Price < maxPrice {
-		fmt.Println("Ticket found for $", cheapestTicket.Price)
-		sendSMS(*cheapestTicket, ethanPhoneNumber)
-		// sendSMS(*cheapestTicket, dadPhoneNumber)
-	}
-}
+	recordCheapestPrice(w, tickets)
 
-func sendSMS(ticket Ticket, phoneNumber string) error {
-	link := fmt.Sprintf("%s&listingId=%d", url, ticket.ID)
-	str := fmt.Sprintf("Ticket found for $%d in section %s, row %s.   Link:%s", ticket.Price, ticket.Section, ticket.Row, link)
+	changes := watcher.recordSuccess(w.ID, tickets, started)
+	if len(changes) > 0 {
+		if err := recordSnapshot(tickets, emptiedFeeds(changes, tickets), started); err != nil {
+			logger.Error("Error recording snapshot", "error", err)
+		}
 
-	messagePayload := map[string]interface{}{
-		"messages": []map[string]string{
-			{
-				"body": str,
-				"to":   phoneNumber,
-			},
-		},
+		stream.publish(changes)
 	}
 
-	payloadBytes, err := json.Marshal(messagePayload)
-	if err != nil {
-		log.Println("Error marshalling JSON:", err)
-		return err
+	// A poll that comes back empty is more often a bad page than a sell
+	// out, and one served by a different source than the last gives the
+	// same listings different IDs, so nothing vanishing from either counts
+	// as sold.
+	saleChanges := changes
+	if len(tickets) == 0 || originSwitched(changes, tickets) {
+		saleChanges = nil
 	}
-	payload := bytes.NewReader(payloadBytes)
-
-	req, err := http.NewRequest("POST", "https://rest.clicksend.com/v3/sms/send", payload)
-	if err != nil {
-		log.Println("Error creating request:", err)
-		return err
+	if len(saleChanges) > 0 || len(sold) > 0 {
+		if err := recordSales(sold, saleChanges, started); err != nil {
+			logger.Error("Error recording sales", "error", err)
+		}
 	}
 
-	apiUsername := os.Getenv("CLICKSEND_USERNAME")
-	apiKey := os.Getenv("CLICKSEND_KEY")
+	logger.Debug("Poll finished", "listings", len(tickets), "changes", len(changes), "took", time.Since(started))
 
-	req.Header.Add("Content-Type", "application/json")
-	req.SetBasicAuth(apiUsername, apiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Error making request:", err)
-		return err
+	if len(tickets) == 0 {
+		logger.Info("No tickets found")
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == 200 {
-		log.Println("SMS sent successfully!")
-	} else {
-		log.Println("Failed to send SMS, status code:", resp.StatusCode)
+	cheapestTicket := getCheapestTicket(tickets, started)
+	if cheapestTicket == nil {
+		logger.Info("No new tickets available")
+		return
 	}
 
-	return err
-}
+	logger = logger.With("listing", cheapestTicket.ID)
+	logger.Info("Cheapest ticket", "price", cheapestTicket.Price, "section", cheapestTicket.Section, "row", cheapestTicket.Row)
 
-func getCheapestTicket() (*Ticket, error) {
-	appData, err := getAppData()
-	if err != nil {
-		return nil, err
+	if cheapestTicket.Price > w.MaxPrice {
+		logger.Info("No tickets available within the price range", "maxPrice", w.MaxPrice)
+		return
 	}
 
-	tickets := []Ticket{}
-	for _, item := range appData.Grid.Items {
-		if item.SoldXTimeAgoSiteMessage.HasValue {
-			continue
+	reason := ""
+	if len(w.Rules) > 0 {
+		cheapestTicket, reason = pickByRules(ctx, w, tickets, started)
+		if cheapestTicket == nil {
+			logger.Info("No tickets beat the market thresholds", "maxPrice", w.MaxPrice)
+			return
 		}
+		logger.Info("Ticket beats the market thresholds", "alertListing", cheapestTicket.ID, "reason", reason)
+	}
 
-		re := regexp.MustCompile("[^0-9]+")
-
-		numericString := re.ReplaceAllString(item.Price, "")
-		price, err := strconv.Atoi(numericString)
+	store.markAlerted(*cheapestTicket, started)
+	logger.Info("Ticket found within the price range", "maxPrice", w.MaxPrice, "price", cheapestTicket.Price)
 
+	note := strings.Join(strings.Fields(reason+" "+forecastNote(ctx, w, *cheapestTicket, tickets, started)+" "+marketNote(w, *cheapestTicket)), " ")
+	for _, phoneNumber := range w.PhoneNumbers {
+		err := sendSMS(ctx, *cheapestTicket, note, phoneNumber)
+		alertsSent.WithLabelValues("sms", outcome(err)).Inc()
 		if err != nil {
-			return nil, err
+			logger.Error("Error sending SMS", "to", phoneNumber, "error", err)
+		} else {
+			logger.Info("SMS sent", "to", phoneNumber)
 		}
 
-		ticket := Ticket{
-			ID:      item.ID,
-			Price:   price,
-			Row:     item.Row,
-			Section: item.Section,
+		if err := recordAlert(*cheapestTicket, phoneNumber, err, started); err != nil {
+			logger.Error("Error recording alert", "error", err)
 		}
+	}
+}
 
-		if set[item.ID] {
+func getCheapestTicket(tickets []Ticket, now time.Time) *Ticket {
+	var cheapestTicket *Ticket
+
+	for _, ticket := range tickets {
+		if store.isSuppressed(ticket.Key(), now) {
 			continue
 		}
 
-		tickets = append(tickets, ticket)
-	}
-
-	if len(tickets) == 0 {
-		return nil, fmt.Errorf("No tickets found")
-	}
-
-	cheapestTicket := tickets[0]
-	for _, ticket := range tickets[1:] {
-		if ticket.Price < cheapestTicket.Price {
-			cheapestTicket = ticket
+		if cheapestTicket == nil || ticket.Price < cheapestTicket.Price {
+			cheapestTicket = &ticket
 		}
 	}
 
-	set[cheapestTicket.ID] = true
-	return &cheapestTicket, nil
+	return cheapestTicket
 }
 
-func getAppData() (*AppData, error) {
-
-	// Create a new HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add headers to prevent caching
-	req.Header.Add("Cache-Control", "no-cache")
-	req.Header.Add("Pragma", "no-cache")
-
-	// Perform the request
-	client := &http.Client{}
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("Error: Failed to fetch the page. Status code: %d", response.StatusCode)
+// recordCheapestPrice sets the cheapest price gauge for each currency the
+// listings are in. Currencies with no listings left are dropped.
+func recordCheapestPrice(w watch, tickets []Ticket) {
+	cheapest := make(map[string]float64)
+	for _, t := range tickets {
+		currency := currencyOf(t)
+		if price, ok := cheapest[currency]; !ok || t.Price < price {
+			cheapest[currency] = t.Price
+		}
 	}
 
-	// Parse the HTML document
-	doc, err := goquery.NewDocumentFromReader(response.Body)
-	if err != nil {
-		return nil, err
+	forgetCheapestPrice(w.Source, w.EventID)
+	for currency, price := range cheapest {
+		cheapestPrice.WithLabelValues(w.Source, w.EventID, currency).Set(price)
 	}
+}
 
-	scriptContent := doc.Find("script#index-data").Text()
-
-	var appData AppData
-	err = json.Unmarshal([]byte(scriptContent), &appData)
-
-	if err != nil {
-		return nil, err
+// reactToClass tells operators when a watch starts getting challenge pages or
+// payloads we can't parse. Outages and recoveries are covered by the stale
+// check.
+func reactToClass(w watch, class string, err error) {
+	switch class {
+	case fetchChallenge:
+		slog.Warn("Bot challenge detected", "watch", w.ID, "error", err)
+		notifyOperatorsLater(fmt.Sprintf("Watcher: %s is being served bot challenges, backing off.", w.ID))
+	case fetchSchemaChanged:
+		slog.Error("Payload schema changed", "watch", w.ID, "error", err)
+		notifyOperatorsLater(fmt.Sprintf("Watcher: %s payload no longer parses, the scraper needs updating. %v", w.ID, err))
 	}
-
-	return &appData, nil
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pollDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "watcher_poll_duration_seconds",
+		Help:    "Time taken to poll a source, by outcome.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30},
+	}, []string{"source", "outcome"})
+
+	httpResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_http_responses_total",
+		Help: "HTTP responses from marketplaces by status code.",
+	}, []string{"source", "code"})
+
+	fetchResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_fetch_results_total",
+		Help: "Polls by how the marketplace response was classified.",
+	}, []string{"source", "class"})
+
+	fetchSkips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_fetch_skips_total",
+		Help: "Polls answered from the last parse, because the server said 304 or the payload hashed the same.",
+	}, []string{"source", "reason"})
+
+	bytesFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_bytes_fetched_total",
+		Help: "Decoded response bytes read from marketplaces.",
+	}, []string{"source"})
+
+	listingsParsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_listings_parsed_total",
+		Help: "Listings turned into tickets.",
+	}, []string{"source"})
+
+	listingsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_listings_rejected_total",
+		Help: "Listings that couldn't be parsed, by reason.",
+	}, []string{"source", "reason"})
+
+	schemaDriftFields = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "watcher_schema_drift_fields",
+		Help: "Fields of the last payload that were unknown, missing or invalid.",
+	}, []string{"source", "kind"})
+
+	cheapestPrice = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "watcher_cheapest_price",
+		Help: "Cheapest listing of each watched event in each currency at the last poll.",
+	}, []string{"source", "event", "currency"})
+
+	alertsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_alerts_total",
+		Help: "Alerts by channel and whether they were delivered.",
+	}, []string{"channel", "outcome"})
+
+	sourceSwitches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_source_switches_total",
+		Help: "Times a fallback source switched between its primary and fallback.",
+	}, []string{"source", "to"})
+
+	fallbackActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "watcher_source_fallback_active",
+		Help: "1 while a fallback source is polling its fallback.",
+	}, []string{"source", "event"})
+
+	proxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watcher_proxy_requests_total",
+		Help: "Marketplace requests sent through each proxy, by outcome.",
+	}, []string{"proxy", "outcome"})
+
+	proxyHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "watcher_proxy_healthy",
+		Help: "0 while a proxy is benched after repeated failures.",
+	}, []string{"proxy"})
+
+	rateLimitWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "watcher_rate_limit_wait_seconds",
+		Help:    "Time marketplace requests were held back by the per-host rate limit.",
+		Buckets: []float64{0, 0.5, 1, 2.5, 5, 10, 20, 30},
+	}, []string{"host"})
+
+	browserInstances = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watcher_browser_instances",
+		Help: "Headless browsers currently running for the rod sources.",
+	})
+)
+
+func observeHttpResponse(source string, statusCode int) {
+	httpResponses.WithLabelValues(source, strconv.Itoa(statusCode)).Inc()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// forgetCheapestPrice drops an event's cheapest price in every currency.
+func forgetCheapestPrice(source, eventID string) {
+	cheapestPrice.DeletePartialMatch(prometheus.Labels{"source": source, "event": eventID})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// TestWriteParquetRoundTrip reads a written file back with parquet-go and
+// checks the schema and every value survive.
+func TestWriteParquetRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 1, 18, 30, 15, 250e6, time.UTC)
+	table := exportTable{
+		name: "observations",
+		columns: []exportColumn{
+			{"observed_at", exportTime},
+			{"source", exportString},
+			{"section", exportString},
+			{"price", exportFloat},
+		},
+		rows: [][]any{
+			{at, "viagogo", "112", 94.5},
+			{at.Add(time.Minute), "twickets-api", "", 120.35},
+			{at.Add(time.Hour), "seatgeek", "Block 305 ünïcode", 0.0},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeParquet(&buf, table); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.NumRows() != int64(len(table.rows)) {
+		t.Errorf("got %d rows, want %d", f.NumRows(), len(table.rows))
+	}
+
+	fields := f.Schema().Fields()
+	if len(fields) != len(table.columns) {
+		t.Fatalf("got %d columns, want %d", len(fields), len(table.columns))
+	}
+	for i, c := range table.columns {
+		if fields[i].Name() != c.name {
+			t.Errorf("column %d is %q, want %q", i, fields[i].Name(), c.name)
+		}
+		if fields[i].Optional() || fields[i].Repeated() {
+			t.Errorf("column %q isn't required", c.name)
+		}
+	}
+	if lt := fields[0].Type().LogicalType(); lt == nil || lt.Timestamp == nil {
+		t.Errorf("observed_at isn't a timestamp")
+	}
+	if lt := fields[1].Type().LogicalType(); lt == nil || lt.UTF8 == nil {
+		t.Errorf("source isn't a UTF-8 string")
+	}
+
+	rows := make([]parquet.Row, 0, len(table.rows))
+	for _, group := range f.RowGroups() {
+		reader := group.Rows()
+		page := make([]parquet.Row, group.NumRows())
+		n, err := reader.ReadRows(page)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		reader.Close()
+		rows = append(rows, page[:n]...)
+	}
+
+	if len(rows) != len(table.rows) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(table.rows))
+	}
+	for i, row := range rows {
+		want := table.rows[i]
+		if got := time.UnixMilli(row[0].Int64()).UTC(); !got.Equal(want[0].(time.Time)) {
+			t.Errorf("row %d observed_at %s, want %s", i, got, want[0])
+		}
+		for _, column := range []int{1, 2} {
+			if got := string(row[column].ByteArray()); got != want[column] {
+				t.Errorf("row %d %s %q, want %q", i, table.columns[column].name, got, want[column])
+			}
+		}
+		if got := row[3].Double(); got != want[3] {
+			t.Errorf("row %d price %g, want %g", i, got, want[3])
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyMaxFailures  = 3
+	proxyBenchTime    = 2 * time.Minute
+	proxyMaxBenchTime = 30 * time.Minute
+)
+
+type proxyKey struct{}
+
+type proxyState struct {
+	url          *url.URL
+	label        string
+	failures     int
+	benches      int
+	benchedUntil time.Time
+}
+
+// proxyPool hands out proxies round robin, benching any that keep failing
+// for a growing interval.
+type proxyPool struct {
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+}
+
+var (
+	proxies = &proxyPool{}
+)
+
+// loadProxies parses PROXIES, a comma separated list of http, https or
+// socks5 proxy URLs.
+func loadProxies(value string) error {
+	pool := &proxyPool{}
+	for _, raw := range strings.Split(value, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid proxy %q: %v", raw, err)
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+
+		// Credentials stay out of logs and metric labels.
+		label := u.Scheme + "://" + u.Host
+		pool.proxies = append(pool.proxies, &proxyState{url: u, label: label})
+		proxyHealthy.WithLabelValues(label).Set(1)
+	}
+
+	proxies = pool
+	return nil
+}
+
+// pick returns the next healthy proxy, or the one that comes off the bench
+// soonest if none are healthy. It returns nil when no proxies are set up.
+func (p *proxyPool) pick(now time.Time) *proxyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.proxies) == 0 {
+		return nil
+	}
+
+	for i := range p.proxies {
+		proxy := p.proxies[(p.next+i)%len(p.proxies)]
+		if !now.Before(proxy.benchedUntil) {
+			p.next = (p.next + i + 1) % len(p.proxies)
+			return proxy
+		}
+	}
+
+	soonest := p.proxies[0]
+	for _, proxy := range p.proxies[1:] {
+		if proxy.benchedUntil.Before(soonest.benchedUntil) {
+			soonest = proxy
+		}
+	}
+
+	return soonest
+}
+
+func (p *proxyPool) report(proxy *proxyState, ok bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ok {
+		proxyRequests.WithLabelValues(proxy.label, "ok").Inc()
+		proxy.failures = 0
+		proxy.benches = 0
+		if !proxy.benchedUntil.IsZero() {
+			proxy.benchedUntil = time.Time{}
+			proxyHealthy.WithLabelValues(proxy.label).Set(1)
+		}
+		return
+	}
+
+	proxyRequests.WithLabelValues(proxy.label, "failed").Inc()
+
+	proxy.failures++
+	if proxy.failures < proxyMaxFailures {
+		return
+	}
+
+	proxy.failures = 0
+	proxy.benches++
+	bench := proxyBenchTime
+	for i := 1; i < proxy.benches && bench < proxyMaxBenchTime; i++ {
+		bench *= 2
+	}
+	proxy.benchedUntil = now.Add(min(bench, proxyMaxBenchTime))
+	proxyHealthy.WithLabelValues(proxy.label).Set(0)
+
+	slog.Warn("Benching proxy", "proxy", proxy.label, "until", proxy.benchedUntil)
+}
+
+// proxyFor is the transport's Proxy func. Marketplace requests carry the
+// proxy proxyTransport picked for them; anything else goes direct or via
+// the environment.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(proxyKey{}).(*proxyState); ok {
+		return proxy.url, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// proxyTransport routes marketplace requests through the pool and reports
+// back whether each proxy got a usable answer.
+type proxyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Value(marketplaceKey{}).(string); !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	proxy := proxies.pick(time.Now())
+	if proxy == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy))
+	resp, err := t.next.RoundTrip(req)
+
+	ok := err == nil
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusForbidden, http.StatusProxyAuthRequired, http.StatusTooManyRequests,
+			http.StatusBadGateway, http.StatusGatewayTimeout:
+			ok = false
+		}
+	}
+	if req.Context().Err() != nil {
+		// A cancelled poll says nothing about the proxy.
+		return resp, err
+	}
+
+	proxies.report(proxy, ok, time.Now())
+	return resp, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The default budget lets a paginated viagogo poll, the event page and
+	// up to viagogoMaxPages grid pages, go out every loop without waiting.
+	rateLimitBurst       = 1 + viagogoMaxPages
+	defaultRatePerMinute = rateLimitBurst * int(time.Minute/loopTime)
+)
+
+// tokenBucket allows rate requests a second on average, with bursts of up
+// to capacity.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate, capacity float64) *tokenBucket {
+	return &tokenBucket{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// wait takes a token, blocking until one is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+type hostLimiter struct {
+	mu      sync.Mutex
+	rates   map[string]float64
+	buckets map[string]*tokenBucket
+	// unlimited lets every request straight through. Replays use it, as
+	// their requests never reach the marketplaces.
+	unlimited bool
+}
+
+var (
+	limiter = &hostLimiter{
+		rates:   make(map[string]float64),
+		buckets: make(map[string]*tokenBucket),
+	}
+)
+
+// loadRateLimits parses RATE_LIMITS, a comma separated list of
+// host=requests/interval entries such as www.viagogo.com=6/1m.
+func loadRateLimits(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		host, limit, ok := strings.Cut(entry, "=")
+		requests, interval, ok2 := strings.Cut(limit, "/")
+		if !ok || !ok2 {
+			return fmt.Errorf("invalid rate limit %q", entry)
+		}
+
+		n, err := strconv.Atoi(requests)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid rate limit %q", entry)
+		}
+
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid rate limit %q", entry)
+		}
+
+		limiter.rates[host] = float64(n) / d.Seconds()
+	}
+
+	return nil
+}
+
+func (l *hostLimiter) bucket(host string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[host]
+	if !ok {
+		rate, ok := l.rates[host]
+		if !ok {
+			rate = float64(defaultRatePerMinute) / 60
+		}
+
+		bucket = newTokenBucket(rate, rateLimitBurst)
+		l.buckets[host] = bucket
+	}
+
+	return bucket
+}
+
+// doRequest sends a request with the shared client. Marketplace requests
+// first wait for their host's budget, so every watch on a host shares it.
+// The wait is only bounded by the request's context: it happens before the
+// client's timeout starts.
+func doRequest(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Value(marketplaceKey{}).(string); ok && !limiter.unlimited {
+		started := time.Now()
+		if err := limiter.bucket(req.URL.Hostname()).wait(req.Context()); err != nil {
+			return nil, err
+		}
+		rateLimitWait.WithLabelValues(req.URL.Hostname()).Observe(time.Since(started).Seconds())
+	}
+
+	return httpClient.Do(req)
+}
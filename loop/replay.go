@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// unreplayableSources read their listings off a browser's network traffic
+// rather than a page or a request of their own, so the archive can't serve
+// them back.
+var unreplayableSources = map[string]bool{
+	"ticketmaster": true,
+}
+
+type capturedMessage struct {
+	At          time.Time
+	PhoneNumber string
+	Body        string
+}
+
+// replayTransport answers marketplace requests with the responses archived
+// for the poll they're made from.
+type replayTransport struct {
+	dir     string
+	mu      sync.Mutex
+	fetches map[string][]archivedFetch
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pollID := pollIDFrom(req.Context())
+
+	fetch := t.take(pollID, func(f archivedFetch) bool {
+		return f.Method == req.Method && archivedURL(f.URL) == archivedURL(req.URL.String())
+	})
+	if fetch == nil {
+		return nil, fmt.Errorf("no archived response for %s %s in poll %s", req.Method, req.URL, pollID)
+	}
+
+	// A 304 only makes sense against the listings the live poller had
+	// cached, which a replay starting mid-way won't have.
+	if fetch.Status == http.StatusNotModified && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		return nil, fmt.Errorf("archived 304 for %s without an earlier response", req.URL)
+	}
+
+	body, err := readArchiveObject(t.dir, fetch.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fetch.Status, http.StatusText(fetch.Status)),
+		StatusCode:    fetch.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fetch.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// take removes and returns the first fetch archived for pollID that match
+// accepts, or nil if there isn't one.
+func (t *replayTransport) take(pollID string, match func(f archivedFetch) bool) *archivedFetch {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, f := range t.fetches[pollID] {
+		if match(f) {
+			t.fetches[pollID] = append(t.fetches[pollID][:i:i], t.fetches[pollID][i+1:]...)
+			return &f
+		}
+	}
+
+	return nil
+}
+
+// has reports whether the poll fetched anything from source.
+func (t *replayTransport) has(pollID, source string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, f := range t.fetches[pollID] {
+		if f.Source == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// twicketsPageSource stands in for the browser scraper in a replay, parsing
+// the page it archived for the poll.
+type twicketsPageSource struct {
+	eventID   string
+	transport *replayTransport
+}
+
+func (s *twicketsPageSource) Name() string {
+	return "twickets-browser"
+}
+
+func (s *twicketsPageSource) GetTickets(ctx context.Context) ([]Ticket, error) {
+	pollID := pollIDFrom(ctx)
+	fetch := s.transport.take(pollID, func(f archivedFetch) bool {
+		return f.Source == s.Name()
+	})
+	if fetch == nil {
+		return nil, fmt.Errorf("no archived page in poll %s", pollID)
+	}
+
+	body, err := readArchiveObject(s.transport.dir, fetch.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTwicketsPage(ctx, body, s.eventID, fetch.URL)
+}
+
+// replaySource returns a source for w that only makes requests the archive
+// can answer. Twickets watches are wrapped and named as they are live, but
+// try the API only in the polls where the live one did.
+func replaySource(w watch, transport *replayTransport) (Source, bool) {
+	switch {
+	case w.Source == "twickets":
+		source := newFallbackSource(w.Source, w.EventID,
+			&twicketsSource{eventID: w.EventID, split: twicketsSplit},
+			&twicketsPageSource{eventID: w.EventID, transport: transport})
+		source.probe = func(ctx context.Context) bool {
+			return transport.has(pollIDFrom(ctx), "twickets-api")
+		}
+		return source, true
+	case w.Source == "twickets-browser":
+		return &twicketsPageSource{eventID: w.EventID, transport: transport}, true
+	case unreplayableSources[w.Source]:
+		return nil, false
+	default:
+		return w.source, true
+	}
+}
+
+// openReplayDB switches to a copy of the database cut back to how it was
+// when the replay starts, so windowed rules and forecasts see the history
+// before it, but nothing the replay records ends up next to the real history.
+// It returns the directory the copy is in.
+func openReplayDB(since time.Time) (string, error) {
+	dir, err := os.MkdirTemp("", "replay")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "replay.db")
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	db.Close()
+	if err := openDB(path); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	for table, column := range map[string]string{"observations": "observed_at", "alerts": "sent_at", "sales": "sold_at"} {
+		if _, err := db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s >= ?`, table, column), since.Unix()); err != nil {
+			return dir, err
+		}
+	}
+
+	_, err = db.Exec(`DELETE FROM fetches; DELETE FROM listing_states`)
+	return dir, err
+}
+
+// runReplay runs the archived polls between -from and -to through the same
+// parse, filter and alert steps as the live loop. Alerts and operator texts
+// are printed instead of sent, and history goes to a throwaway copy of the database.
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := flags.String("from", "", "start of the range to replay (RFC3339)")
+	to := flags.String("to", "", "end of the range to replay (RFC3339), defaults to now")
+	maxPrice := flags.Float64("max-price", 0, "max price to use for every watch instead of its own")
+	flags.Parse(args)
+
+	since, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		fatal("Invalid -from", "error", err)
+	}
+
+	until := time.Now()
+	if *to != "" {
+		until, err = time.Parse(time.RFC3339, *to)
+		if err != nil {
+			fatal("Invalid -to", "error", err)
+		}
+	}
+
+	fetches, err := getFetches(since, until)
+	if err != nil {
+		fatal("Error reading archive", "error", err)
+	}
+
+	dir, err := openReplayDB(since)
+	if err != nil {
+		fatal("Error opening replay database", "error", err)
+	}
+	defer os.RemoveAll(dir)
+
+	transport := &replayTransport{
+		dir:     envOr("ARCHIVE_DIR", defaultArchiveDir),
+		fetches: make(map[string][]archivedFetch),
+	}
+	polls := make([]archivedFetch, 0)
+	for _, f := range fetches {
+		if unreplayableSources[f.Source] {
+			continue
+		}
+
+		if _, ok := transport.fetches[f.PollID]; !ok {
+			polls = append(polls, f)
+		}
+		transport.fetches[f.PollID] = append(transport.fetches[f.PollID], f)
+	}
+	httpClient = &http.Client{Transport: transport}
+	limiter = &hostLimiter{unlimited: true}
+
+	watches := make(map[string]watch)
+	for _, w := range registry.list() {
+		source, ok := replaySource(w, transport)
+		if !ok {
+			continue
+		}
+
+		w.source = source
+		if *maxPrice > 0 {
+			w.MaxPrice = *maxPrice
+		}
+		watches[w.ID] = w
+	}
+
+	var mu sync.Mutex
+	var clock time.Time
+	messages := make([]capturedMessage, 0)
+	sendMessage = func(ctx context.Context, str string, phoneNumber string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		messages = append(messages, capturedMessage{At: clock, PhoneNumber: phoneNumber, Body: str})
+		return nil
+	}
+
+	replayed, skipped := 0, 0
+	for _, p := range polls {
+		w, ok := watches[p.WatchID]
+		if !ok {
+			skipped++
+			continue
+		}
+
+		mu.Lock()
+		clock = p.FetchedAt
+		mu.Unlock()
+
+		watcher.recordStart(w.ID, p.FetchedAt)
+		poll(pollContext(w, p.PollID), w, p.FetchedAt)
+		operatorNotices.Wait()
+		replayed++
+	}
+
+	for _, m := range messages {
+		fmt.Printf("%s\t%s\t%s\n", m.At.Format(time.RFC3339), m.PhoneNumber, m.Body)
+	}
+	fmt.Fprintf(os.Stderr, "Replayed %d polls (%d skipped for unwatched or unreplayable sources), %d messages captured.\n", replayed, skipped, len(messages))
+}
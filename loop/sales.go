@@ -0,0 +1,137 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// saleMarker is a sale the marketplace showed as sold.
+	saleMarker = "marker"
+	// saleVanished is a listing that disappeared between two polls. It may
+	// have been withdrawn rather than bought.
+	saleVanished = "vanished"
+)
+
+var soldAgoPattern = regexp.MustCompile(`(?i)(\d+)\s*(minute|min|hour|hr|day)`)
+
+// Sale is a listing we think was bought, at the last price it was seen at.
+type Sale struct {
+	SoldAt   time.Time `json:"soldAt"`
+	Ticket   Ticket    `json:"ticket"`
+	Evidence string    `json:"evidence"`
+}
+
+// parseSoldAgo reads how long ago a listing sold from a message like "Sold 3
+// hours ago". It's zero when the message doesn't say.
+func parseSoldAgo(message string) time.Duration {
+	match := soldAgoPattern.FindStringSubmatch(message)
+	if match == nil {
+		return 0
+	}
+
+	n, _ := strconv.Atoi(match[1])
+	switch match[2][0] {
+	case 'm', 'M':
+		return time.Duration(n) * time.Minute
+	case 'h', 'H':
+		return time.Duration(n) * time.Hour
+	default:
+		return time.Duration(n) * 24 * time.Hour
+	}
+}
+
+// splitSold separates the listings a source marked as sold from the live
+// ones.
+func splitSold(tickets []Ticket) ([]Ticket, []Ticket) {
+	live := make([]Ticket, 0, len(tickets))
+	sold := make([]Ticket, 0)
+	for _, t := range tickets {
+		if t.Sold {
+			sold = append(sold, t)
+		} else {
+			live = append(live, t)
+		}
+	}
+
+	return live, sold
+}
+
+// recordSales stores the sales seen in a poll: listings marked as sold and
+// listings that vanished since the previous poll. A listing is only stored
+// once, and a sold marker replaces an earlier guess from it vanishing.
+// Listings that come back are no longer counted as sold.
+func recordSales(sold []Ticket, changes []ListingChange, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(`INSERT INTO sales (sold_at, source, event_id, listing_id, section, row, price, currency, evidence) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (source, event_id, listing_id) DO UPDATE SET sold_at = excluded.sold_at, price = excluded.price, evidence = excluded.evidence
+		WHERE sales.evidence = '` + saleVanished + `' AND excluded.evidence = '` + saleMarker + `'`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	relisted, err := tx.Prepare(`DELETE FROM sales WHERE source = ? AND event_id = ? AND listing_id = ? AND evidence = '` + saleVanished + `'`)
+	if err != nil {
+		return err
+	}
+	defer relisted.Close()
+
+	for _, c := range changes {
+		t := c.Ticket
+		switch c.Type {
+		case changeSold:
+			_, err = insert.Exec(now.Unix(), t.Source, t.EventID, t.ID, t.Section, t.Row, t.Price, t.Currency, saleVanished)
+		case changeNew:
+			_, err = relisted.Exec(t.Source, t.EventID, t.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range sold {
+		if _, err := insert.Exec(now.Add(-t.SoldAgo).Unix(), t.Source, t.EventID, t.ID, t.Section, t.Row, t.Price, t.Currency, saleMarker); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func getSales(filter observationFilter) ([]Sale, error) {
+	condition, args := filterCondition(filter, "sold_at")
+	query := `SELECT sold_at, source, event_id, listing_id, section, row, price, currency, evidence FROM sales WHERE ` + condition + ` ORDER BY sold_at`
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := make([]Sale, 0)
+	for rows.Next() {
+		var sale Sale
+		var soldAt int64
+		t := &sale.Ticket
+		if err := rows.Scan(&soldAt, &t.Source, &t.EventID, &t.ID, &t.Section, &t.Row, &t.Price, &t.Currency, &sale.Evidence); err != nil {
+			return nil, err
+		}
+
+		sale.SoldAt = time.Unix(soldAt, 0)
+		sales = append(sales, sale)
+	}
+
+	return sales, rows.Err()
+}
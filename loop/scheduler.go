@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	maxBackoff       = 10 * time.Minute
+	challengeBackoff = 5 * time.Minute
+)
+
+type pollPlan struct {
+	skipUntil time.Time
+	backoffs  int
+	lastClass string
+}
+
+// pollScheduler decides how each watch is polled based on how its recent
+// fetches were classified.
+type pollScheduler struct {
+	mu    sync.Mutex
+	plans map[string]*pollPlan
+}
+
+var (
+	scheduler = &pollScheduler{
+		plans: make(map[string]*pollPlan),
+	}
+)
+
+func (s *pollScheduler) plan(watchID string) *pollPlan {
+	plan, ok := s.plans[watchID]
+	if !ok {
+		plan = &pollPlan{}
+		s.plans[watchID] = plan
+	}
+
+	return plan
+}
+
+// shouldPoll returns false while the watch is backing off.
+func (s *pollScheduler) shouldPoll(w watch, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !now.Before(s.plan(w.ID).skipUntil)
+}
+
+// react records the class of a poll and schedules the next one. It reports
+// whether the class differs from the watch's previous poll.
+func (s *pollScheduler) react(w watch, err error, class string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan := s.plan(w.ID)
+	changed := class != plan.lastClass
+	plan.lastClass = class
+
+	var retryAfter time.Duration
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		retryAfter = fetchErr.RetryAfter
+	}
+
+	switch class {
+	case fetchOK, fetchEmpty:
+		plan.backoffs = 0
+		plan.skipUntil = time.Time{}
+	case fetchRateLimited, fetchMaintenance:
+		plan.backoffs++
+		plan.skipUntil = now.Add(max(retryAfter, backoff(plan.backoffs)))
+	case fetchChallenge:
+		plan.backoffs++
+		plan.skipUntil = now.Add(max(retryAfter, challengeBackoff, backoff(plan.backoffs)))
+	}
+
+	return changed
+}
+
+func (s *pollScheduler) forget(watchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.plans, watchID)
+}
+
+// backoff doubles the loop interval for every consecutive poll we've been
+// pushed back on, up to maxBackoff.
+func backoff(attempts int) time.Duration {
+	d := loopTime
+	for i := 0; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, maxBackoff)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSchemaSampleDir = "schema-samples"
+)
+
+// schemaDrift describes how the listings in a payload differ from the struct
+// they're decoded into.
+type schemaDrift struct {
+	// Unknown fields appear in the payload but not in the struct.
+	Unknown []string
+	// Missing fields are required by the struct but absent from every
+	// listing.
+	Missing []string
+	// Invalid counts listings rejected per required field that was empty
+	// or unusable, e.g. a zero price.
+	Invalid map[string]int
+}
+
+// signature identifies the shape of a payload's fields, so operators are
+// only texted when it changes. Invalid listings come and go with individual
+// sellers and are left to the logs and metrics, unless every listing is
+// invalid and the poll fails as schema_changed.
+func (d schemaDrift) signature() string {
+	if len(d.Unknown) == 0 && len(d.Missing) == 0 {
+		return ""
+	}
+	return strings.Join(d.Unknown, ",") + "|" + strings.Join(d.Missing, ",")
+}
+
+func (d schemaDrift) String() string {
+	parts := make([]string, 0, 3)
+	if len(d.Unknown) > 0 {
+		parts = append(parts, "unknown fields "+strings.Join(d.Unknown, ", "))
+	}
+	if len(d.Missing) > 0 {
+		parts = append(parts, "missing fields "+strings.Join(d.Missing, ", "))
+	}
+	if len(d.Invalid) > 0 {
+		invalid := make([]string, 0, len(d.Invalid))
+		for field, count := range d.Invalid {
+			invalid = append(invalid, fmt.Sprintf("%s (%d)", field, count))
+		}
+		sort.Strings(invalid)
+		parts = append(parts, "invalid "+strings.Join(invalid, ", "))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// compareFields checks the keys of every listing in items against the json
+// fields of T. Pointer and omitempty fields are optional.
+func compareFields[T any](items []json.RawMessage) schemaDrift {
+	expected := make(map[string]bool)
+	t := reflect.TypeFor[T]()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		expected[name] = field.Type.Kind() != reflect.Pointer && !strings.Contains(opts, "omitempty")
+	}
+
+	unknown := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, item := range items {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(item, &fields); err != nil {
+			continue
+		}
+
+		for name := range fields {
+			seen[name] = true
+			if _, ok := expected[name]; !ok {
+				unknown[name] = true
+			}
+		}
+	}
+
+	drift := schemaDrift{Invalid: make(map[string]int)}
+	for name := range unknown {
+		drift.Unknown = append(drift.Unknown, name)
+	}
+	for name, required := range expected {
+		if required && !seen[name] && len(items) > 0 {
+			drift.Missing = append(drift.Missing, name)
+		}
+	}
+	sort.Strings(drift.Unknown)
+	sort.Strings(drift.Missing)
+
+	return drift
+}
+
+type schemaMonitor struct {
+	mu         sync.Mutex
+	signatures map[string]string
+	sampleDir  string
+}
+
+var (
+	schemas = &schemaMonitor{
+		signatures: make(map[string]string),
+		sampleDir:  defaultSchemaSampleDir,
+	}
+)
+
+// report records the drift of the latest payload for a source's event. When
+// its shape changes, a sample of the payload is saved to SCHEMA_SAMPLE_DIR
+// and operators are texted.
+func (m *schemaMonitor) report(ctx context.Context, source, eventID string, drift schemaDrift, sample []byte) {
+	schemaDriftFields.WithLabelValues(source, "unknown").Set(float64(len(drift.Unknown)))
+	schemaDriftFields.WithLabelValues(source, "missing").Set(float64(len(drift.Missing)))
+	schemaDriftFields.WithLabelValues(source, "invalid").Set(float64(len(drift.Invalid)))
+
+	logger := loggerFrom(ctx)
+	if len(drift.Invalid) > 0 {
+		logger.Warn("Listings failed validation", "drift", drift.String())
+	}
+
+	key := source + ":" + eventID
+	signature := drift.signature()
+
+	m.mu.Lock()
+	previous := m.signatures[key]
+	m.signatures[key] = signature
+	m.mu.Unlock()
+
+	if signature == previous {
+		return
+	}
+
+	if signature == "" {
+		logger.Info("Payload matches the expected schema again")
+		notifyOperatorsLater(fmt.Sprintf("Watcher: %s payloads for %s match the expected schema again.", source, eventID))
+		return
+	}
+
+	logger.Warn("Payload schema drifted", "drift", drift.String())
+
+	path, err := m.saveSample(ctx, source, sample)
+	if err != nil {
+		logger.Warn("Could not save schema sample", "error", err)
+	}
+
+	notifyOperatorsLater(fmt.Sprintf("Watcher: %s payload for %s drifted from the expected schema: %s. Sample: %s", source, eventID, drift, path))
+}
+
+func (m *schemaMonitor) saveSample(ctx context.Context, source string, sample []byte) (string, error) {
+	if err := os.MkdirAll(m.sampleDir, 0o755); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.json", time.Now().Format("20060102-150405"), source, pollIDFrom(ctx))
+	path := filepath.Join(m.sampleDir, name)
+
+	return path, os.WriteFile(path, sample, 0o644)
+}
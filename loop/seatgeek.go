@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+)
+
+const (
+	seatgeekListingsUrl = "https://seatgeek.com/api/event_listings_v2?id=%s&client_id=%s"
+	seatgeekEventUrl    = "https://seatgeek.com/e/%s?quantity=%d&listing_id=%s"
+	seatgeekQuantity    = 2
+	// The listing grid doesn't say what currency its prices are in, which
+	// is the currency of the SeatGeek site the event is sold on.
+	defaultSeatgeekCurrency = "USD"
+)
+
+// seatgeekListing is one listing in the event_listings_v2 payload, which
+// uses single letter keys to keep the grid small. Prices are per ticket.
+type seatgeekListing struct {
+	ID            string  `json:"id"`
+	Section       string  `json:"s"`
+	Row           string  `json:"r"`
+	Quantity      int     `json:"q"`
+	Splits        []int   `json:"sp"`
+	Price         float64 `json:"p"`
+	PriceWithFees float64 `json:"pf"`
+	Fees          float64 `json:"f"`
+	// DealQuality is SeatGeek's 0-100 deal score, missing for listings it
+	// hasn't rated.
+	DealQuality *float64 `json:"dq"`
+}
+
+type seatgeekResponse struct {
+	Listings json.RawMessage `json:"listings"`
+}
+
+type seatgeekSource struct {
+	eventID  string
+	quantity int
+	memo     fetchMemo
+}
+
+func (s *seatgeekSource) Name() string {
+	return "seatgeek"
+}
+
+func (s *seatgeekSource) GetTickets(ctx context.Context) ([]Ticket, error) {
+	u := fmt.Sprintf(seatgeekListingsUrl, url.QueryEscape(s.eventID), url.QueryEscape(os.Getenv("SEATGEEK_CLIENT_ID")))
+	body, v, err := getListingsJSON(ctx, s.Name(), "seatgeek", u, "listings", &s.memo)
+	if err != nil {
+		return nil, err
+	}
+
+	if tickets, ok := s.memo.reuse(s.Name(), body); ok {
+		return tickets, nil
+	}
+
+	tickets, drift, err := parseSeatgeekListings(ctx, body, s.eventID, s.quantity, envOr("SEATGEEK_CURRENCY", defaultSeatgeekCurrency))
+	if err != nil {
+		return nil, err
+	}
+
+	schemas.report(ctx, s.Name(), s.eventID, drift, body)
+	if len(tickets) == 0 && len(drift.Invalid) > 0 {
+		return nil, schemaChanged("every listing failed validation: %s", drift)
+	}
+
+	s.memo.store(v, body, tickets)
+
+	return tickets, nil
+}
+
+// parseSeatgeekListings returns the listings in an event_listings_v2 payload
+// that can be bought in the given quantity, priced in currency.
+func parseSeatgeekListings(ctx context.Context, body []byte, eventID string, quantity int, currency string) ([]Ticket, schemaDrift, error) {
+	var data seatgeekResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, schemaDrift{}, schemaChanged("Error parsing JSON: %v", err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data.Listings, &raw); err != nil {
+		return nil, schemaDrift{}, schemaChanged("listings missing: %v", err)
+	}
+
+	var listings []seatgeekListing
+	if err := json.Unmarshal(data.Listings, &listings); err != nil {
+		return nil, schemaDrift{}, schemaChanged("Error parsing listings: %v", err)
+	}
+
+	drift := compareFields[seatgeekListing](raw)
+
+	tickets := make([]Ticket, 0)
+	for _, listing := range listings {
+		if !slices.Contains(listing.Splits, quantity) {
+			continue
+		}
+
+		if listing.ID == "" {
+			listingsRejected.WithLabelValues("seatgeek", "id").Inc()
+			drift.Invalid["id"]++
+			continue
+		}
+
+		if listing.PriceWithFees <= 0 {
+			listingsRejected.WithLabelValues("seatgeek", "price").Inc()
+			drift.Invalid["pf"]++
+			continue
+		}
+
+		if listing.Section == "" {
+			listingsRejected.WithLabelValues("seatgeek", "section").Inc()
+			drift.Invalid["s"]++
+			continue
+		}
+
+		ticket := Ticket{
+			Source:   "seatgeek",
+			EventID:  eventID,
+			ID:       listing.ID,
+			Price:    listing.PriceWithFees,
+			Fees:     listing.Fees,
+			Row:      listing.Row,
+			Section:  listing.Section,
+			Quantity: listing.Quantity,
+			Link:     fmt.Sprintf(seatgeekEventUrl, eventID, quantity, listing.ID),
+			Currency: currency,
+		}
+		if listing.DealQuality != nil {
+			ticket.Score = *listing.DealQuality
+		}
+
+		listingsParsed.WithLabelValues("seatgeek").Inc()
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets, drift, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseSeatgeekListings(t *testing.T) {
+	body, err := os.ReadFile("testdata/seatgeek-listings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The deal score becomes the listing score, and stays zero for
+	// listings SeatGeek hasn't rated.
+	rated := Ticket{Source: "seatgeek", EventID: "6120033", ID: "7712093341", Price: 176.84, Fees: 34.84, Row: "14", Section: "112", Quantity: 4, Score: 87, Link: "https://seatgeek.com/e/6120033?quantity=2&listing_id=7712093341", Currency: "USD"}
+	unrated := Ticket{Source: "seatgeek", EventID: "6120033", ID: "7712093342", Price: 78.25, Fees: 17.25, Row: "3", Section: "318", Quantity: 2, Link: "https://seatgeek.com/e/6120033?quantity=2&listing_id=7712093342", Currency: "USD"}
+	single := Ticket{Source: "seatgeek", EventID: "6120033", ID: "7712093343", Price: 118.6, Fees: 23.6, Row: "22", Section: "140", Quantity: 3, Score: 64, Link: "https://seatgeek.com/e/6120033?quantity=1&listing_id=7712093343", Currency: "USD"}
+
+	tests := []struct {
+		name     string
+		quantity int
+		want     []Ticket
+		invalid  map[string]int
+	}{
+		{
+			name:     "pairs",
+			quantity: 2,
+			want:     []Ticket{rated, unrated},
+			invalid:  map[string]int{"s": 1, "pf": 1},
+		},
+		{
+			name:     "singles",
+			quantity: 1,
+			want:     []Ticket{single},
+			invalid:  map[string]int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tickets, drift, err := parseSeatgeekListings(context.Background(), body, "6120033", test.quantity, "USD")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(tickets, test.want) {
+				t.Errorf("got tickets\n%+v\nwant\n%+v", tickets, test.want)
+			}
+			if !maps.Equal(drift.Invalid, test.invalid) {
+				t.Errorf("got invalid %v, want %v", drift.Invalid, test.invalid)
+			}
+		})
+	}
+}
+
+func TestParseSeatgeekListingsMissing(t *testing.T) {
+	if _, _, err := parseSeatgeekListings(context.Background(), []byte(`{"meta":{}}`), "1", 2, "USD"); err == nil {
+		t.Error("expected an error for a payload without listings")
+	}
+}
+
+// TestSeatgeekSource runs polls through GetTickets: the whole grid comes
+// from one request, priced in SEATGEEK_CURRENCY, an event with nothing
+// listed is an empty poll rather than an error, and a payload without
+// listings is a schema change.
+func TestSeatgeekSource(t *testing.T) {
+	t.Setenv("SEATGEEK_CLIENT_ID", "client")
+	t.Setenv("SEATGEEK_CURRENCY", "GBP")
+	requested := serveJSON(t,
+		`{"listings":[{"id":"1","s":"112","r":"14","q":2,"sp":[2],"p":80,"pf":96.5,"f":16.5,"dq":70},{"id":"2","s":"318","r":"3","q":4,"sp":[2,4],"p":60,"pf":72,"f":12}]}`,
+		`{"listings":[]}`,
+		`{"meta":{"total":0}}`,
+	)
+	s := &seatgeekSource{eventID: "6120033", quantity: 2}
+
+	tickets, err := s.GetTickets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tickets) != 2 {
+		t.Fatalf("got %d tickets, want 2", len(tickets))
+	}
+	for _, ticket := range tickets {
+		if ticket.Currency != "GBP" {
+			t.Errorf("listing %s in %q, want GBP", ticket.ID, ticket.Currency)
+		}
+	}
+	want := []string{"https://seatgeek.com/api/event_listings_v2?id=6120033&client_id=client"}
+	if !slices.Equal(*requested, want) {
+		t.Errorf("requested %v, want %v", *requested, want)
+	}
+
+	tickets, err = s.GetTickets(context.Background())
+	if err != nil || len(tickets) != 0 {
+		t.Errorf("empty listings gave %v, %v, want no tickets and no error", tickets, err)
+	}
+
+	if _, err := s.GetTickets(context.Background()); fetchClass(err) != fetchSchemaChanged {
+		t.Errorf("payload without listings gave %v, want a schema change", err)
+	}
+}
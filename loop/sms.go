@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// sendSMS texts an alert for ticket. note, if any, compares it with the other
+// marketplaces watching the same fixture.
+func sendSMS(ctx context.Context, ticket Ticket, note string, phoneNumber string) error {
+	str := fmt.Sprintf("Ticket found for %s in section %s, row %s.", formatPrice(ticket.Price, ticket.Currency), ticket.Section, ticket.Row)
+	if note != "" {
+		str += " " + note
+	}
+	str += fmt.Sprintf("   Link:%s   Ack/snooze:%s", ticket.Link, ackLink(ticket))
+
+	return sendMessage(ctx, str, phoneNumber)
+}
+
+// sendMessage delivers a text. Replays swap it out to capture messages
+// instead.
+var sendMessage = sendClickSend
+
+func sendClickSend(ctx context.Context, str string, phoneNumber string) error {
+	messagePayload := map[string]interface{}{
+		"messages": []map[string]string{
+			{
+				"body": str,
+				"to":   phoneNumber,
+			},
+		},
+	}
+
+	payloadBytes, err := json.Marshal(messagePayload)
+	if err != nil {
+		return fmt.Errorf("Error marshalling JSON: %v", err)
+	}
+	payload := bytes.NewReader(payloadBytes)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://rest.clicksend.com/v3/sms/send", payload)
+	if err != nil {
+		return fmt.Errorf("Error creating request: %v", err)
+	}
+
+	apiUsername := os.Getenv("CLICKSEND_USERNAME")
+	apiKey := os.Getenv("CLICKSEND_KEY")
+
+	req.Header.Add("Content-Type", "application/json")
+	req.SetBasicAuth(apiUsername, apiKey)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Failed to send SMS, status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
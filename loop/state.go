@@ -0,0 +1,274 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	changeNew      = "new"
+	changeRepriced = "repriced"
+	changeSold     = "sold"
+)
+
+type ListingChange struct {
+	Type          string    `json:"type"`
+	At            time.Time `json:"at"`
+	Ticket        Ticket    `json:"ticket"`
+	PreviousPrice float64   `json:"previousPrice,omitempty"`
+}
+
+type PollStatus struct {
+	Watch       string        `json:"watch"`
+	FirstPoll   time.Time     `json:"firstPoll"`
+	LastPoll    time.Time     `json:"lastPoll"`
+	LastSuccess time.Time     `json:"lastSuccess"`
+	LastError   string        `json:"lastError,omitempty"`
+	LastClass   string        `json:"lastClass,omitempty"`
+	Listings    int           `json:"listings"`
+	Duration    time.Duration `json:"duration"`
+	Stale       bool          `json:"stale"`
+}
+
+// watcherState holds the latest poll of each watch for the dashboard and API.
+type watcherState struct {
+	mu       sync.Mutex
+	polls    map[string]*PollStatus
+	listings map[string][]Ticket
+	inFlight map[string]bool
+}
+
+var (
+	watcher = &watcherState{
+		polls:    make(map[string]*PollStatus),
+		listings: make(map[string][]Ticket),
+		inFlight: make(map[string]bool),
+	}
+)
+
+// beginPoll claims a watch for one poll. It returns false while the previous
+// poll of the watch is still running, so slow polls don't overlap.
+func (s *watcherState) beginPoll(watchID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inFlight[watchID] {
+		return false
+	}
+	s.inFlight[watchID] = true
+	return true
+}
+
+func (s *watcherState) endPoll(watchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inFlight, watchID)
+}
+
+// poll returns the status of a watch, or nil once the watch is removed, so
+// a poll still in flight when it goes doesn't bring its status back.
+func (s *watcherState) poll(watchID string) *PollStatus {
+	if _, ok := registry.get(watchID); !ok {
+		return nil
+	}
+
+	status, ok := s.polls[watchID]
+	if !ok {
+		status = &PollStatus{Watch: watchID}
+		s.polls[watchID] = status
+	}
+
+	return status
+}
+
+func (s *watcherState) recordStart(watchID string, started time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.poll(watchID)
+	if status == nil {
+		return
+	}
+	if status.FirstPoll.IsZero() {
+		status.FirstPoll = started
+	}
+}
+
+func (s *watcherState) recordFailure(watchID string, err error, started time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.poll(watchID)
+	if status == nil {
+		return
+	}
+	status.LastPoll = started
+	status.LastError = err.Error()
+	status.LastClass = fetchClass(err)
+	status.Duration = time.Since(started)
+}
+
+// recordSuccess saves the listings of a poll and returns how they differ from
+// the previous poll of the same watch. Polls of removed watches are dropped.
+func (s *watcherState) recordSuccess(watchID string, tickets []Ticket, started time.Time) []ListingChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.poll(watchID)
+	if status == nil {
+		return nil
+	}
+	status.LastPoll = started
+	status.LastSuccess = started
+	status.LastError = ""
+	status.LastClass = fetchOK
+	if len(tickets) == 0 {
+		status.LastClass = fetchEmpty
+	}
+	status.Listings = len(tickets)
+	status.Duration = time.Since(started)
+
+	changes := diffListings(s.listings[watchID], tickets, started)
+	s.listings[watchID] = tickets
+
+	return changes
+}
+
+func (s *watcherState) forget(watchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.polls, watchID)
+	delete(s.listings, watchID)
+}
+
+func (s *watcherState) getPolls() []PollStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	polls := make([]PollStatus, 0, len(s.polls))
+	for _, status := range s.polls {
+		polls = append(polls, *status)
+	}
+
+	sort.Slice(polls, func(i, j int) bool {
+		return polls[i].Watch < polls[j].Watch
+	})
+
+	return polls
+}
+
+func (s *watcherState) getListings() map[string][]Ticket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listings := make(map[string][]Ticket, len(s.listings))
+	for watchID, tickets := range s.listings {
+		listings[watchID] = append([]Ticket(nil), tickets...)
+	}
+
+	return listings
+}
+
+// diffListings compares two polls of the same watch. A listing missing from
+// the latest poll is reported as sold: the marketplaces don't tell us whether
+// it was bought or withdrawn.
+func diffListings(prev, cur []Ticket, now time.Time) []ListingChange {
+	changes := make([]ListingChange, 0)
+
+	previous := make(map[string]Ticket, len(prev))
+	for _, t := range prev {
+		previous[t.Key()] = t
+	}
+
+	current := make(map[string]bool, len(cur))
+	for _, t := range cur {
+		if current[t.Key()] {
+			continue
+		}
+		current[t.Key()] = true
+
+		old, ok := previous[t.Key()]
+		switch {
+		case !ok:
+			changes = append(changes, ListingChange{Type: changeNew, At: now, Ticket: t})
+		case old.Price != t.Price:
+			changes = append(changes, ListingChange{Type: changeRepriced, At: now, Ticket: t, PreviousPrice: old.Price})
+		}
+	}
+
+	for key, t := range previous {
+		if !current[key] {
+			changes = append(changes, ListingChange{Type: changeSold, At: now, Ticket: t, PreviousPrice: t.Price})
+		}
+	}
+
+	return matchRepriced(changes)
+}
+
+// contentIDSources make up listing IDs from what a listing shows, price
+// included, so a repriced listing comes back under a new ID.
+var contentIDSources = map[string]bool{
+	"twickets-browser": true,
+}
+
+// matchRepriced turns a listing from a content ID source that went and a new
+// one in the same seats into a reprice, rather than a sale and a new listing.
+// It goes by where the listing came from, so fallback listings reported
+// under their primary's name are matched too.
+func matchRepriced(changes []ListingChange) []ListingChange {
+	seatsOf := func(t Ticket) string {
+		return strings.Join([]string{t.Source, t.origin(), t.EventID, t.Section, t.Row, t.Seats}, "|")
+	}
+
+	gone := make(map[string][]int)
+	for i, c := range changes {
+		if c.Type == changeSold && contentIDSources[c.Ticket.origin()] {
+			gone[seatsOf(c.Ticket)] = append(gone[seatsOf(c.Ticket)], i)
+		}
+	}
+	if len(gone) == 0 {
+		return changes
+	}
+
+	matched := make(map[int]bool)
+	for i, c := range changes {
+		key := seatsOf(c.Ticket)
+		if c.Type != changeNew || len(gone[key]) == 0 {
+			continue
+		}
+
+		j := gone[key][0]
+		gone[key] = gone[key][1:]
+		matched[j] = true
+		changes[i] = ListingChange{Type: changeRepriced, At: c.At, Ticket: c.Ticket, PreviousPrice: changes[j].Ticket.Price}
+	}
+
+	kept := make([]ListingChange, 0, len(changes)-len(matched))
+	for i, c := range changes {
+		if !matched[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// originSwitched reports whether listings went from a source none of the
+// current ones came from, as when a fallback takes over or hands back.
+func originSwitched(changes []ListingChange, tickets []Ticket) bool {
+	origins := make(map[string]bool)
+	for _, t := range tickets {
+		origins[t.origin()] = true
+	}
+
+	for _, c := range changes {
+		if c.Type == changeSold && !origins[c.Ticket.origin()] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDiffListings(t *testing.T) {
+	now := time.Now()
+	browser := func(price float64, section, row int) Ticket {
+		return Ticket{Source: "twickets-browser", EventID: "1", ID: generateID(price, row, section), Price: price, Section: strconv.Itoa(section), Row: strconv.Itoa(row)}
+	}
+	fallback := func(t Ticket) Ticket {
+		t.Origin, t.Source = t.Source, "twickets"
+		return t
+	}
+
+	tests := []struct {
+		name      string
+		prev, cur []Ticket
+		want      []string
+	}{
+		{
+			name: "repriced",
+			prev: []Ticket{{Source: "viagogo", ID: "1", Price: 100}},
+			cur:  []Ticket{{Source: "viagogo", ID: "1", Price: 90}},
+			want: []string{"repriced 90 from 100"},
+		},
+		{
+			name: "new and gone",
+			prev: []Ticket{{Source: "viagogo", ID: "1", Section: "112", Price: 100}},
+			cur:  []Ticket{{Source: "viagogo", ID: "2", Section: "112", Price: 90}},
+			want: []string{"new 90 from 0", "sold 100 from 100"},
+		},
+		{
+			// The browser scraper's IDs change with the price.
+			name: "content ID repriced",
+			prev: []Ticket{browser(100, 112, 3), browser(80, 140, 9)},
+			cur:  []Ticket{browser(95, 112, 3), browser(80, 140, 9)},
+			want: []string{"repriced 95 from 100"},
+		},
+		{
+			// Browser listings the twickets fallback reports under its
+			// own name.
+			name: "fallback content ID repriced",
+			prev: []Ticket{fallback(browser(100, 112, 3))},
+			cur:  []Ticket{fallback(browser(95, 112, 3))},
+			want: []string{"repriced 95 from 100"},
+		},
+		{
+			name: "content ID gone",
+			prev: []Ticket{browser(100, 112, 3), browser(80, 140, 9)},
+			cur:  []Ticket{browser(85, 140, 8)},
+			want: []string{"new 85 from 0", "sold 100 from 100", "sold 80 from 80"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, c := range diffListings(test.prev, test.cur, now) {
+				got = append(got, fmt.Sprintf("%s %g from %g", c.Type, c.Ticket.Price, c.PreviousPrice))
+			}
+			slices.Sort(got)
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestOriginSwitched checks listings going because the fallback took over
+// or handed back aren't taken for sales, while ones going from the same
+// source are.
+func TestOriginSwitched(t *testing.T) {
+	api := Ticket{Source: "twickets", EventID: "1", ID: "7", Section: "112", Row: "3", Price: 100}
+	browser := Ticket{Source: "twickets", Origin: "twickets-browser", EventID: "1", ID: generateID(100, 3, 112), Section: "112", Row: "3", Price: 100}
+	other := Ticket{Source: "twickets", EventID: "1", ID: "8", Section: "140", Row: "9", Price: 80}
+
+	tests := []struct {
+		name      string
+		prev, cur []Ticket
+		want      bool
+	}{
+		{"fallback takes over", []Ticket{api}, []Ticket{browser}, true},
+		{"primary recovers", []Ticket{browser}, []Ticket{api}, true},
+		{"sold on the primary", []Ticket{api, other}, []Ticket{other}, false},
+		{"nothing went", []Ticket{api}, []Ticket{api, other}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := diffListings(test.prev, test.cur, time.Now())
+			if got := originSwitched(changes, test.cur); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestRecordAfterRemove checks a poll that finishes after its watch is
+// removed doesn't bring the watch's status back.
+func TestRecordAfterRemove(t *testing.T) {
+	w := &watch{ID: "viagogo-removed", Source: "viagogo", EventID: "removed"}
+	if err := registry.add(w); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	watcher.recordStart(w.ID, started)
+	registry.remove(w.ID)
+	watcher.forget(w.ID)
+
+	if changes := watcher.recordSuccess(w.ID, []Ticket{{Source: "viagogo", ID: "1", Price: 90}}, started); len(changes) != 0 {
+		t.Errorf("got %d changes for a removed watch", len(changes))
+	}
+	watcher.recordFailure(w.ID, fmt.Errorf("timed out"), started)
+
+	for _, status := range watcher.getPolls() {
+		if status.Watch == w.ID {
+			t.Errorf("removed watch has a poll status again: %+v", status)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listingState is what we remember about a listing once it has been alerted
+// on or actioned from an alert link.
+type listingState struct {
+	Ticket       Ticket
+	AlertedAt    time.Time
+	Acked        bool
+	Blacklisted  bool
+	SnoozedUntil time.Time
+}
+
+// Store is the dedupe store shared by every watch. Listings are keyed by
+// source and marketplace ID, see Ticket.Key.
+type Store struct {
+	mu       sync.Mutex
+	listings map[string]*listingState
+	// remindAfter is how long after an alert a listing that wasn't acked
+	// can be alerted on again. Zero alerts on every listing once.
+	remindAfter time.Duration
+}
+
+var (
+	store = newStore()
+)
+
+func newStore() *Store {
+	return &Store{
+		listings: make(map[string]*listingState),
+	}
+}
+
+func (s *Store) get(key string) (listingState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.listings[key]
+	if !ok {
+		return listingState{}, false
+	}
+
+	return *state, true
+}
+
+func (s *Store) state(key string) *listingState {
+	state, ok := s.listings[key]
+	if !ok {
+		state = &listingState{}
+		s.listings[key] = state
+	}
+
+	return state
+}
+
+// loadStoreConfig reads REMIND_AFTER, e.g. 1h. Reminders are off unless it's
+// set.
+func loadStoreConfig() error {
+	remindAfter, err := time.ParseDuration(envOr("REMIND_AFTER", "0s"))
+	if err != nil || remindAfter < 0 {
+		return fmt.Errorf("invalid REMIND_AFTER")
+	}
+	store.remindAfter = remindAfter
+
+	return nil
+}
+
+// load restores what was alerted and actioned before a restart.
+func (s *Store) load() error {
+	rows, err := db.Query(`SELECT source, event_id, listing_id, section, row, price, link, currency, alerted_at, acked, blacklisted, snoozed_until FROM listing_states`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for rows.Next() {
+		var state listingState
+		var alertedAt, snoozedUntil int64
+		t := &state.Ticket
+		if err := rows.Scan(&t.Source, &t.EventID, &t.ID, &t.Section, &t.Row, &t.Price, &t.Link, &t.Currency, &alertedAt, &state.Acked, &state.Blacklisted, &snoozedUntil); err != nil {
+			return err
+		}
+
+		state.AlertedAt = unixOrZero(alertedAt)
+		state.SnoozedUntil = unixOrZero(snoozedUntil)
+		s.listings[t.Key()] = &state
+	}
+
+	return rows.Err()
+}
+
+// splitKey is the reverse of Ticket.Key.
+func splitKey(key string) (string, string) {
+	source, id, _ := strings.Cut(key, ":")
+	return source, id
+}
+
+func unixOrZero(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func zeroOrUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// save writes a listing's state through to the database. It's called with
+// s.mu held.
+func (s *Store) save(key string, state *listingState) {
+	if db == nil {
+		return
+	}
+
+	source, id := state.Ticket.Source, state.Ticket.ID
+	if source == "" {
+		source, id = splitKey(key)
+	}
+
+	t := state.Ticket
+	_, err := db.Exec(`INSERT INTO listing_states (source, event_id, listing_id, section, row, price, link, currency, alerted_at, acked, blacklisted, snoozed_until) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (source, listing_id) DO UPDATE SET event_id = excluded.event_id, section = excluded.section, row = excluded.row, price = excluded.price, link = excluded.link, currency = excluded.currency,
+		alerted_at = excluded.alerted_at, acked = excluded.acked, blacklisted = excluded.blacklisted, snoozed_until = excluded.snoozed_until`,
+		source, t.EventID, id, t.Section, t.Row, t.Price, t.Link, t.Currency, zeroOrUnix(state.AlertedAt), state.Acked, state.Blacklisted, zeroOrUnix(state.SnoozedUntil))
+	if err != nil {
+		slog.Error("Error saving listing state", "listing", key, "error", err)
+	}
+}
+
+// isSuppressed reports whether a listing should be skipped when picking the
+// next ticket to alert on: acked and blacklisted listings are skipped for
+// good, snoozed ones until the snooze runs out, and alerted ones until
+// remindAfter has passed, or for good if there are no reminders.
+func (s *Store) isSuppressed(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.listings[key]
+	if !ok {
+		return false
+	}
+
+	if state.Acked || state.Blacklisted {
+		return true
+	}
+
+	if now.Before(state.SnoozedUntil) {
+		return true
+	}
+
+	if state.AlertedAt.IsZero() {
+		return false
+	}
+	return s.remindAfter == 0 || now.Sub(state.AlertedAt) < s.remindAfter
+}
+
+func (s *Store) markAlerted(ticket Ticket, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(ticket.Key())
+	state.Ticket = ticket
+	state.AlertedAt = now
+	s.save(ticket.Key(), state)
+}
+
+func (s *Store) ack(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(key)
+	state.Acked = true
+	s.save(key, state)
+}
+
+func (s *Store) snooze(key string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(key)
+	state.SnoozedUntil = until
+	// The snooze replaces the reminder, so don't hold the listing back any
+	// longer than asked once it runs out.
+	state.AlertedAt = time.Time{}
+	s.save(key, state)
+}
+
+func (s *Store) blacklist(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(key)
+	state.Blacklisted = true
+	s.save(key, state)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	streamBuffer    = 64
+	streamKeepAlive = 15 * time.Second
+)
+
+type streamSubscriber struct {
+	source  string
+	eventID string
+	changes chan ListingChange
+}
+
+// changeStream fans the listing changes found by each poll out to the
+// clients connected to /api/v1/stream.
+type changeStream struct {
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]bool
+}
+
+var (
+	stream = &changeStream{
+		subscribers: make(map[*streamSubscriber]bool),
+	}
+)
+
+func (s *changeStream) subscribe(source, eventID string) *streamSubscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := &streamSubscriber{
+		source:  source,
+		eventID: eventID,
+		changes: make(chan ListingChange, streamBuffer),
+	}
+	s.subscribers[sub] = true
+
+	return sub
+}
+
+func (s *changeStream) unsubscribe(sub *streamSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscribers, sub)
+}
+
+func (sub *streamSubscriber) wants(t Ticket) bool {
+	return (sub.source == "" || sub.source == t.Source) && (sub.eventID == "" || sub.eventID == t.EventID)
+}
+
+// publish never blocks a poll: a client that can't keep up misses changes
+// rather than holding up the loop.
+func (s *changeStream) publish(changes []ListingChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subscribers {
+		for _, change := range changes {
+			if !sub.wants(change.Ticket) {
+				continue
+			}
+
+			select {
+			case sub.changes <- change:
+			default:
+				slog.Warn("Stream client too slow, dropped change", "source", change.Ticket.Source, "event", change.Ticket.EventID, "listing", change.Ticket.ID)
+			}
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, eventType string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+	return err
+}
+
+// handleApiStream serves listing changes as Server-Sent Events. It starts
+// with a snapshot of the matching listings so clients don't have to call
+// /api/v1/listings first.
+func handleApiStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	sub := stream.subscribe(r.URL.Query().Get("source"), r.URL.Query().Get("event"))
+	defer stream.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	snapshot := make([]Ticket, 0)
+	for _, tickets := range watcher.getListings() {
+		for _, t := range tickets {
+			if sub.wants(t) {
+				snapshot = append(snapshot, t)
+			}
+		}
+	}
+
+	if err := writeStreamEvent(w, "snapshot", snapshot); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case change := <-sub.changes:
+			if err := writeStreamEvent(w, change.Type, change); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
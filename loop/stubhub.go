@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	stubhubEventUrl = "https://www.stubhub.com/event/%s?quantity=2"
+)
+
+func extractStubhubEventID(url string) (string, error) {
+	re := regexp.MustCompile(`/event/(\d+)`)
+
+	match := re.FindStringSubmatch(url)
+	if len(match) < 2 {
+		return "", fmt.Errorf("could not extract event ID from %s", url)
+	}
+
+	return match[1], nil
+}
+
+// newStubhubSource polls a StubHub event page. StubHub serves the same
+// index-data grid as viagogo, so only the URLs differ.
+func newStubhubSource(url, eventID string) *viagogoSource {
+	return &viagogoSource{marketplace: "stubhub", url: url, eventID: eventID}
+}
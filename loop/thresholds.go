@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// minRuleSample is the fewest prices a market statistic is worked out
+	// from. With fewer, the rule isn't met.
+	minRuleSample = 3
+)
+
+var ruleStatistics = map[string]float64{
+	"min":    0,
+	"p10":    0.1,
+	"median": 0.5,
+}
+
+// ThresholdRule alerts on listings priced relative to the market rather than
+// at a fixed cap, e.g. 20% below the section median, or below the 10th
+// percentile of the last 24 hours. Every rule of a watch has to be met, and
+// maxPrice still applies.
+type ThresholdRule struct {
+	// Below is the statistic the price is compared with: min, p10 or
+	// median.
+	Below string `json:"below"`
+	// Percent is how far below it the price has to be.
+	Percent float64 `json:"percent,omitempty"`
+	// Scope is section, the default, or event.
+	Scope string `json:"scope,omitempty"`
+	// Window, e.g. 24h, takes the statistic over every listing seen in
+	// that time instead of the current ones.
+	Window string `json:"window,omitempty"`
+}
+
+func (r ThresholdRule) validate() error {
+	if _, ok := ruleStatistics[r.Below]; !ok {
+		return fmt.Errorf("rule below must be min, p10 or median, not %q", r.Below)
+	}
+
+	if r.Percent < 0 || r.Percent >= 100 {
+		return fmt.Errorf("rule percent must be between 0 and 100")
+	}
+
+	if r.Scope != "" && r.Scope != "section" && r.Scope != "event" {
+		return fmt.Errorf("rule scope must be section or event, not %q", r.Scope)
+	}
+
+	if r.Window != "" {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window <= 0 {
+			return fmt.Errorf("invalid rule window %q", r.Window)
+		}
+	}
+
+	return nil
+}
+
+// reference names what a rule compares with, e.g. "section median of the
+// last 24h".
+func (r ThresholdRule) reference() string {
+	scope := r.Scope
+	if scope == "" {
+		scope = "section"
+	}
+
+	str := scope + " " + r.Below
+	if r.Window != "" {
+		str += " of the last " + r.Window
+	}
+	return str
+}
+
+func (r ThresholdRule) String() string {
+	if r.Percent > 0 {
+		return fmt.Sprintf("%g%% below the %s", r.Percent, r.reference())
+	}
+	return "below the " + r.reference()
+}
+
+// marketPrices looks up the prices rules are checked against, caching them
+// for the rest of a poll.
+type marketPrices struct {
+	tickets []Ticket
+	now     time.Time
+	cache   map[string][]float64
+}
+
+func newMarketPrices(tickets []Ticket, now time.Time) *marketPrices {
+	return &marketPrices{tickets: tickets, now: now, cache: make(map[string][]float64)}
+}
+
+// prices returns the sorted prices in the scope of a rule around t: the
+// current listings, or each listing's lowest price over the rule's window,
+// counting those still up from before it.
+func (m *marketPrices) prices(r ThresholdRule, t Ticket) ([]float64, error) {
+	area := ""
+	if r.Scope != "event" {
+		area = normaliseArea(t.Section)
+	}
+
+	key := strings.Join([]string{r.Scope, r.Window, area, currencyOf(t)}, "|")
+	if prices, ok := m.cache[key]; ok {
+		return prices, nil
+	}
+
+	inScope := func(other Ticket) bool {
+		return (area == "" || normaliseArea(other.Section) == area) && currencyOf(other) == currencyOf(t)
+	}
+
+	prices := make([]float64, 0)
+	if r.Window == "" {
+		for _, other := range m.tickets {
+			if inScope(other) {
+				prices = append(prices, other.Price)
+			}
+		}
+	} else {
+		window, _ := time.ParseDuration(r.Window)
+		since := m.now.Add(-window)
+		filter := observationFilter{
+			Source:  t.Source,
+			EventID: t.EventID,
+			Until:   m.now.Add(time.Second),
+		}
+
+		// Snapshots are only stored when the listings change, so the
+		// replay starts at the one in force when the window opens.
+		from, err := snapshotsFrom(filter, since)
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = from
+
+		snapshots, err := getSnapshots(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		lowest := make(map[string]float64)
+		for i, snapshot := range snapshots {
+			if i+1 < len(snapshots) && !snapshots[i+1].at.After(since) {
+				continue
+			}
+			for _, other := range snapshot.tickets {
+				if !inScope(other) {
+					continue
+				}
+				if price, ok := lowest[other.Key()]; !ok || other.Price < price {
+					lowest[other.Key()] = other.Price
+				}
+			}
+		}
+		for _, price := range lowest {
+			prices = append(prices, price)
+		}
+	}
+
+	sort.Float64s(prices)
+	m.cache[key] = prices
+	return prices, nil
+}
+
+// meetsRules reports whether t beats every rule of w, and says how in a
+// few words for the alert.
+func meetsRules(ctx context.Context, w watch, t Ticket, market *marketPrices) (bool, string) {
+	logger := loggerFrom(ctx)
+
+	reasons := make([]string, 0, len(w.Rules))
+	for _, rule := range w.Rules {
+		prices, err := market.prices(rule, t)
+		if err != nil {
+			logger.Error("Error loading prices for threshold rule", "rule", rule.String(), "error", err)
+			return false, ""
+		}
+
+		if len(prices) < minRuleSample {
+			logger.Debug("Too few prices for threshold rule", "rule", rule.String(), "prices", len(prices))
+			return false, ""
+		}
+
+		reference := percentile(prices, ruleStatistics[rule.Below])
+		if t.Price > reference*(1-rule.Percent/100) {
+			return false, ""
+		}
+
+		reasons = append(reasons, fmt.Sprintf("%.0f%% below the %s (%s).", (1-t.Price/reference)*100, rule.reference(), formatPrice(reference, t.Currency)))
+	}
+
+	return true, strings.Join(reasons, " ")
+}
+
+// pickByRules returns the cheapest listing within maxPrice that beats every
+// threshold rule of w.
+func pickByRules(ctx context.Context, w watch, tickets []Ticket, now time.Time) (*Ticket, string) {
+	candidates := make([]Ticket, 0, len(tickets))
+	for _, t := range tickets {
+		if t.Price <= w.MaxPrice && !store.isSuppressed(t.Key(), now) {
+			candidates = append(candidates, t)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Price < candidates[j].Price
+	})
+
+	market := newMarketPrices(tickets, now)
+	for _, t := range candidates {
+		if ok, reason := meetsRules(ctx, w, t, market); ok {
+			return &t, reason
+		}
+	}
+
+	return nil, ""
+}
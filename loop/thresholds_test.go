@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWindowedPrices checks a windowed rule counts the listings in force
+// when the window opens, even when the market hasn't changed since, and
+// that an empty poll before the window ends them.
+func TestWindowedPrices(t *testing.T) {
+	if err := openDB(filepath.Join(t.TempDir(), "watcher.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Date(2026, 10, 3, 12, 0, 0, 0, time.UTC)
+	listed := func(eventID string) []Ticket {
+		return []Ticket{
+			{Source: "viagogo", EventID: eventID, ID: "a", Section: "112", Price: 90},
+			{Source: "viagogo", EventID: eventID, ID: "b", Section: "112", Price: 110},
+			{Source: "viagogo", EventID: eventID, ID: "c", Section: "Block 112", Price: 130},
+		}
+	}
+
+	// Event 1 was listed two days ago and hasn't changed.
+	if err := recordSnapshot(listed("1"), nil, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Event 2 was listed at the same time, then sold out before the window.
+	if err := recordSnapshot(listed("2"), nil, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordSnapshot([]Ticket{}, [][2]string{{"viagogo", "2"}}, now.Add(-30*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	rule := ThresholdRule{Below: "median", Window: "24h"}
+	tests := []struct {
+		eventID string
+		want    int
+	}{
+		{"1", 3},
+		{"2", 0},
+	}
+
+	for _, test := range tests {
+		market := newMarketPrices(nil, now)
+		prices, err := market.prices(rule, Ticket{Source: "viagogo", EventID: test.eventID, Section: "112"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prices) != test.want {
+			t.Errorf("event %s: got prices %v, want %d of them", test.eventID, prices, test.want)
+		}
+	}
+}
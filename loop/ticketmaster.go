@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	ticketmasterEventUrl = "https://www.ticketmaster.co.uk/event/%s"
+	ticketmasterQuantity = 2
+	ticketmasterWait     = 45 * time.Second
+)
+
+// ticketmasterOffer is one priced offer in a quickpicks response. Prices are
+// per ticket, totalPrice including Ticketmaster's fees.
+type ticketmasterOffer struct {
+	OfferID            string  `json:"offerId"`
+	InventoryType      string  `json:"inventoryType"`
+	ListingID          string  `json:"listingId,omitempty"`
+	Currency           string  `json:"currency"`
+	ListPrice          float64 `json:"listPrice"`
+	TotalPrice         float64 `json:"totalPrice"`
+	SellableQuantities []int   `json:"sellableQuantities"`
+}
+
+type ticketmasterPick struct {
+	Type    string   `json:"type"`
+	Section string   `json:"section"`
+	Row     string   `json:"row"`
+	Offers  []string `json:"offers"`
+}
+
+type ticketmasterQuickpicks struct {
+	Picks    []ticketmasterPick `json:"picks"`
+	Embedded struct {
+		Offer []json.RawMessage `json:"offer"`
+	} `json:"_embedded"`
+}
+
+// ticketmasterSource polls fan-to-fan resale on a Ticketmaster event. The
+// offer API only answers requests made by the event page itself, so the page
+// is loaded in a browser and its quickpicks response is read off the wire.
+type ticketmasterSource struct {
+	eventID  string
+	quantity int
+}
+
+func (s *ticketmasterSource) Name() string {
+	return "ticketmaster"
+}
+
+func (s *ticketmasterSource) GetTickets(ctx context.Context) (tickets []Ticket, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("browser scrape failed: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, ticketmasterWait)
+	defer cancel()
+
+	page, closeBrowser, err := newBrowserPage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("launching browser: %v", err)
+	}
+	defer closeBrowser()
+
+	var requestID proto.NetworkRequestID
+	var response *proto.NetworkResponse
+	var body []byte
+	var bodyErr error
+	wait := page.EachEvent(func(e *proto.NetworkResponseReceived) {
+		if requestID == "" && strings.Contains(e.Response.URL, "/quickpicks") {
+			requestID = e.RequestID
+			response = e.Response
+		}
+	}, func(e *proto.NetworkLoadingFinished) bool {
+		if requestID == "" || e.RequestID != requestID {
+			return false
+		}
+
+		res, err := proto.NetworkGetResponseBody{RequestID: requestID}.Call(page)
+		if err != nil {
+			bodyErr = err
+			return true
+		}
+
+		body = []byte(res.Body)
+		if res.Base64Encoded {
+			body, bodyErr = base64.StdEncoding.DecodeString(res.Body)
+		}
+		return true
+	})
+
+	url := fmt.Sprintf(ticketmasterEventUrl, s.eventID)
+	page.MustNavigate(url)
+	wait()
+
+	if bodyErr != nil {
+		return nil, fmt.Errorf("reading quickpicks response: %v", bodyErr)
+	}
+	if body == nil {
+		return nil, fmt.Errorf("event page made no quickpicks request within %s", ticketmasterWait)
+	}
+
+	observeHttpResponse(s.Name(), response.Status)
+	capturePage(ctx, s.Name(), "json", body)
+	archiveFetch(ctx, archivedFetch{Source: s.Name(), Method: "GET", URL: response.URL, Status: response.Status}, body)
+
+	if fetchErr := classifyResponse(&http.Response{StatusCode: response.Status, Header: http.Header{}}, body, "picks"); fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	tickets, drift, err := parseTicketmasterOffers(ctx, body, s.eventID, s.quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas.report(ctx, s.Name(), s.eventID, drift, body)
+	if len(tickets) == 0 && len(drift.Invalid) > 0 {
+		return nil, schemaChanged("every listing failed validation: %s", drift)
+	}
+
+	return tickets, nil
+}
+
+// parseTicketmasterOffers returns the resale offers in a quickpicks response
+// that can be bought in the given quantity, priced all-in with the fees
+// broken out.
+func parseTicketmasterOffers(ctx context.Context, body []byte, eventID string, quantity int) ([]Ticket, schemaDrift, error) {
+	var data ticketmasterQuickpicks
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, schemaDrift{}, schemaChanged("Error parsing quickpicks: %v", err)
+	}
+
+	drift := compareFields[ticketmasterOffer](data.Embedded.Offer)
+
+	offers := make(map[string]ticketmasterOffer)
+	for _, raw := range data.Embedded.Offer {
+		var offer ticketmasterOffer
+		if err := json.Unmarshal(raw, &offer); err != nil {
+			drift.Invalid["offer"]++
+			continue
+		}
+		offers[offer.OfferID] = offer
+	}
+
+	tickets := make([]Ticket, 0)
+	seen := make(map[string]bool)
+	for _, pick := range data.Picks {
+		for _, offerID := range pick.Offers {
+			offer, ok := offers[offerID]
+			if !ok || offer.InventoryType != "resale" || !slices.Contains(offer.SellableQuantities, quantity) {
+				continue
+			}
+
+			if offer.TotalPrice <= 0 {
+				listingsRejected.WithLabelValues("ticketmaster", "price").Inc()
+				drift.Invalid["totalPrice"]++
+				continue
+			}
+
+			if pick.Section == "" {
+				listingsRejected.WithLabelValues("ticketmaster", "section").Inc()
+				drift.Invalid["section"]++
+				continue
+			}
+
+			// One listing can turn up in several picks.
+			id := offer.ListingID
+			if id == "" {
+				id = offer.OfferID
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			ticket := Ticket{
+				Source:   "ticketmaster",
+				EventID:  eventID,
+				ID:       id,
+				Price:    offer.TotalPrice,
+				Row:      pick.Row,
+				Section:  pick.Section,
+				Quantity: slices.Max(offer.SellableQuantities),
+				Link:     fmt.Sprintf(ticketmasterEventUrl, eventID),
+				Currency: offer.Currency,
+			}
+			if offer.ListPrice > 0 && offer.ListPrice < offer.TotalPrice {
+				ticket.Fees = math.Round((offer.TotalPrice-offer.ListPrice)*100) / 100
+			}
+
+			listingsParsed.WithLabelValues("ticketmaster").Inc()
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	loggerFrom(ctx).Debug("Parsed quickpicks", "picks", len(data.Picks), "offers", len(offers), "tickets", len(tickets))
+
+	return tickets, drift, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseTicketmasterOffers(t *testing.T) {
+	body, err := os.ReadFile("testdata/ticketmaster-quickpicks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "https://www.ticketmaster.co.uk/event/1F00611BE1D27A2B"
+	pair := Ticket{Source: "ticketmaster", EventID: "1F00611BE1D27A2B", ID: "8731920011", Price: 94.5, Fees: 14.5, Row: "F", Section: "112", Quantity: 4, Link: link, Currency: "GBP"}
+	// Offers without a listing ID go by their offer ID.
+	noListingID := Ticket{Source: "ticketmaster", EventID: "1F00611BE1D27A2B", ID: "c9Pt-resale-4", Price: 120.35, Fees: 18.35, Section: "204", Quantity: 2, Link: link, Currency: "GBP"}
+	single := Ticket{Source: "ticketmaster", EventID: "1F00611BE1D27A2B", ID: "8731920042", Price: 47.6, Fees: 7.6, Row: "K", Section: "301", Quantity: 3, Link: link, Currency: "GBP"}
+
+	tests := []struct {
+		name     string
+		quantity int
+		want     []Ticket
+		invalid  map[string]int
+	}{
+		{
+			name:     "pairs",
+			quantity: 2,
+			want:     []Ticket{pair, noListingID},
+			invalid:  map[string]int{"section": 1, "totalPrice": 1},
+		},
+		{
+			name:     "singles",
+			quantity: 1,
+			want:     []Ticket{single},
+			invalid:  map[string]int{},
+		},
+		{
+			name:     "fours",
+			quantity: 4,
+			want:     []Ticket{pair},
+			invalid:  map[string]int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tickets, drift, err := parseTicketmasterOffers(context.Background(), body, "1F00611BE1D27A2B", test.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(tickets, test.want) {
+				t.Errorf("got tickets\n%+v\nwant\n%+v", tickets, test.want)
+			}
+			if !maps.Equal(drift.Invalid, test.invalid) {
+				t.Errorf("got invalid %v, want %v", drift.Invalid, test.invalid)
+			}
+		})
+	}
+}
+
+func TestParseTicketmasterOffersBadJSON(t *testing.T) {
+	if _, _, err := parseTicketmasterOffers(context.Background(), []byte("<html>"), "1", 2); err == nil {
+		t.Error("expected an error for a body that isn't JSON")
+	}
+}
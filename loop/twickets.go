@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+const (
+	twicketsTicketsUrl = "https://www.twickets.live/app/block/"
+	twicketsApiUrl     = "https://www.twickets.live/services/g2/inventory/listings/%s?api_key=83d6ec0c-54bb-4da3-b2a1-f3cb47b984f1"
+	twicketsEventID    = "1836398181106065408"
+	twicketsSplit      = 2
+)
+
+type Pricing struct {
+	Options string  `json:"options"`
+	Prices  []Price `json:"prices"`
+}
+
+type Price struct {
+	ID              *string `json:"id"`
+	CurrencyCode    string  `json:"currencyCode"`
+	Label           string  `json:"label"`
+	FaceValue       float64 `json:"faceValue"`
+	OriginalFee     float64 `json:"originalFee"`
+	NetFee          float64 `json:"netFee"`
+	NetSellingPrice float64 `json:"netSellingPrice"`
+}
+
+type ResponseData struct {
+	Type                     string          `json:"type"`
+	Area                     string          `json:"area"`
+	Section                  string          `json:"section"`
+	Row                      string          `json:"row"`
+	ID                       string          `json:"id"`
+	Pricing                  Pricing         `json:"pricing"`
+	CommonAttributes         []interface{}   `json:"commonAttributes"`
+	IndividualAttributes     [][]interface{} `json:"individualAttributes"`
+	Splits                   []int           `json:"splits"`
+	DeliveryMethodTypes      []string        `json:"deliveryMethodTypes"`
+	SellerWillConsiderOffers bool            `json:"sellerWillConsiderOffers"`
+	SegmentID                string          `json:"segmentId"`
+}
+
+// Response is the inventory envelope. responseData is kept raw so it can be
+// hashed before it's decoded.
+type Response struct {
+	ResponseData json.RawMessage `json:"responseData"`
+	ResponseCode int             `json:"responseCode"`
+	Description  string          `json:"description"`
+	Clock        string          `json:"clock"`
+}
+
+type twicketsSource struct {
+	eventID string
+	split   int
+	memo    fetchMemo
+}
+
+func (s *twicketsSource) Name() string {
+	return "twickets-api"
+}
+
+func (s *twicketsSource) GetTickets(ctx context.Context) ([]Ticket, error) {
+	payload, v, err := getResponseData(ctx, fmt.Sprintf(twicketsApiUrl, s.eventID), &s.memo)
+	if err != nil {
+		return nil, err
+	}
+
+	if tickets, ok := s.memo.reuse(s.Name(), payload); ok {
+		return tickets, nil
+	}
+
+	var responseData []ResponseData
+	if err := json.Unmarshal(payload, &responseData); err != nil {
+		return nil, schemaChanged("Error parsing responseData: %v", err)
+	}
+
+	var raw []json.RawMessage
+	json.Unmarshal(payload, &raw)
+	drift := compareFields[ResponseData](raw)
+
+	tickets := getRelevantTickets(ctx, responseData, s.eventID, s.split, drift.Invalid)
+
+	schemas.report(ctx, s.Name(), s.eventID, drift, payload)
+	if len(tickets) == 0 && len(drift.Invalid) > 0 {
+		return nil, schemaChanged("every listing failed validation: %s", drift)
+	}
+
+	s.memo.store(v, payload, tickets)
+
+	return tickets, nil
+}
+
+// getResponseData returns the raw responseData array of an inventory
+// response, leaving decoding it to the caller so unchanged payloads can be
+// skipped. A nil payload means the server answered 304.
+func getResponseData(ctx context.Context, url string, memo *fetchMemo) (json.RawMessage, validators, error) {
+	req, err := newRequest(ctx, "twickets", "GET", url, nil)
+	if err != nil {
+		return nil, validators{}, fmt.Errorf("Error creating request: %v", err)
+	}
+	memo.prepare(req)
+
+	resp, err := doRequest(req)
+	if err != nil {
+		return nil, validators{}, fmt.Errorf("Error making HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	observeHttpResponse("twickets-api", resp.StatusCode)
+
+	if resp.StatusCode == http.StatusNotModified {
+		archiveResponse(ctx, "twickets-api", resp, nil)
+		return nil, validators{}, nil
+	}
+
+	body, err := io.ReadAll(&countingReader{source: "twickets-api", r: resp.Body})
+	if err != nil {
+		return nil, validators{}, fmt.Errorf("Error reading response body: %v", err)
+	}
+	capturePage(ctx, "twickets-api", "json", body)
+	archiveResponse(ctx, "twickets-api", resp, body)
+
+	if fetchErr := classifyResponse(resp, body, "responseData"); fetchErr != nil {
+		return nil, validators{}, fetchErr
+	}
+
+	var data Response
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, validators{}, schemaChanged("Error parsing JSON: %v", err)
+	}
+
+	if len(data.ResponseData) == 0 || string(data.ResponseData) == "null" {
+		return nil, validators{}, schemaChanged("responseData missing, response code %d: %s", data.ResponseCode, data.Description)
+	}
+
+	return data.ResponseData, validatorsOf(resp), nil
+}
+
+func extractId(str string) (string, error) {
+	re := regexp.MustCompile(`@(.+)`)
+
+	match := re.FindStringSubmatch(str)
+
+	if len(match) > 1 {
+		return match[1], nil
+	}
+
+	return "", fmt.Errorf("No match found")
+}
+
+// getRelevantTickets returns the listings that can be bought in the given
+// split. Listings missing a required field are counted in invalid by field.
+func getRelevantTickets(ctx context.Context, responseDatas []ResponseData, eventID string, split int, invalid map[string]int) []Ticket {
+	tickets := make([]Ticket, 0)
+
+	for _, responseData := range responseDatas {
+
+		if !slices.Contains(responseData.Splits, split) {
+			continue
+		}
+
+		id, err := extractId(responseData.ID)
+		if err != nil {
+			listingsRejected.WithLabelValues("twickets-api", "id").Inc()
+			loggerFrom(ctx).Warn("Error extracting ID", "id", responseData.ID, "error", err)
+			invalid["id"]++
+			continue
+		}
+
+		if len(responseData.Pricing.Prices) == 0 || responseData.Pricing.Prices[0].NetSellingPrice <= 0 {
+			listingsRejected.WithLabelValues("twickets-api", "price").Inc()
+			invalid["price"]++
+			continue
+		}
+
+		if responseData.Section == "" {
+			listingsRejected.WithLabelValues("twickets-api", "section").Inc()
+			invalid["section"]++
+			continue
+		}
+
+		ticketPrice := responseData.Pricing.Prices[0]
+		p := (ticketPrice.NetSellingPrice + ticketPrice.NetFee) / 100
+		ticket := Ticket{
+			Source:  "twickets-api",
+			EventID: eventID,
+			ID:      id,
+			Price:   p,
+			Fees:    ticketPrice.NetFee / 100,
+			Row:     responseData.Row,
+			Section: responseData.Section,
+			Link:    fmt.Sprintf("%s%s,%d", twicketsTicketsUrl, id, split),
+		}
+
+		listingsParsed.WithLabelValues("twickets-api").Inc()
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	twicketsEventUrl = "https://www.twickets.live/en/event/%s#sort=FirstListed&typeFilter=Any&qFilter=1"
+)
+
+type twicketsBrowserSource struct {
+	eventID string
+}
+
+func (s *twicketsBrowserSource) Name() string {
+	return "twickets-browser"
+}
+
+func (s *twicketsBrowserSource) GetTickets(ctx context.Context) (tickets []Ticket, err error) {
+	// rod reports failures by panicking, which would take every other watch
+	// down with this one.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("browser scrape failed: %v", r)
+		}
+	}()
+
+	page, closeBrowser, err := newBrowserPage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("launching browser: %v", err)
+	}
+	defer closeBrowser()
+
+	url := fmt.Sprintf(twicketsEventUrl, s.eventID)
+	page.MustNavigate(url).MustWaitNavigation()
+
+	page.MustWaitIdle()
+	page.MustWaitRequestIdle()
+	page.MustWaitDOMStable()
+
+	page.MustElement(".container.sort-filter-row.list-group-item.not-football").MustWaitVisible()
+
+	body := []byte(page.MustElement("html").MustHTML())
+	capturePage(ctx, s.Name(), "html", body)
+	archiveFetch(ctx, archivedFetch{Source: s.Name(), Method: "GET", URL: url, Status: http.StatusOK}, body)
+
+	return parseTwicketsPage(ctx, body, s.eventID, url)
+}
+
+// parseTwicketsPage reads the listings out of an event page's HTML. Live
+// polls and replays of their archived pages both go through it, so a replay
+// doesn't need a browser to see what the live poll saw.
+func parseTwicketsPage(ctx context.Context, body []byte, eventID, url string) ([]Ticket, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := make([]Ticket, 0)
+	for _, detail := range elementsWithClass(doc, "details-container") {
+		ticket, err := extractTicketInfo(nodeText(detail))
+		if err != nil {
+			listingsRejected.WithLabelValues("twickets-browser", "ticket_info").Inc()
+			loggerFrom(ctx).Debug("Could not extract ticket info", "error", err)
+			continue
+		}
+
+		ticket.Source = "twickets-browser"
+		ticket.EventID = eventID
+		ticket.Link = url
+		listingsParsed.WithLabelValues("twickets-browser").Inc()
+		tickets = append(tickets, *ticket)
+	}
+
+	return tickets, nil
+}
+
+// elementsWithClass returns the elements under n with the given class, in
+// document order.
+func elementsWithClass(n *html.Node, class string) []*html.Node {
+	found := make([]*html.Node, 0)
+	if n.Type == html.ElementNode && hasClass(n, class) {
+		found = append(found, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, elementsWithClass(c, class)...)
+	}
+	return found
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" && slices.Contains(strings.Fields(attr.Val), class) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeText is the text under n with whitespace collapsed, close enough to
+// the rendered text for extractTicketInfo. Elements other than inline ones
+// are kept apart by a space, as the browser would on separate lines.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && !inlineElements[n.Data]
+		if block {
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			b.WriteString(" ")
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "cite": true, "code": true,
+	"em": true, "i": true, "label": true, "small": true, "span": true,
+	"strong": true, "sub": true, "sup": true, "time": true, "u": true,
+}
+
+func generateID(price float64, row, section int) string {
+	data := fmt.Sprintf("%.2f:%d:%d", price, section, row)
+
+	hash := sha256.New()
+	hash.Write([]byte(data))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func extractPrice(input string) (float64, error) {
+	pricePattern := `£(\d+\.\d{2})`
+	re := regexp.MustCompile(pricePattern)
+
+	priceMatch := re.FindStringSubmatch(input)
+
+	if len(priceMatch) < 2 {
+		return 0, fmt.Errorf("could not extract price")
+	}
+
+	price, err := strconv.ParseFloat(priceMatch[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse price: %v", err)
+	}
+
+	return price, nil
+}
+
+func extractSection(input string) (int, error) {
+	sectionPattern := `Section (\d+)`
+	re := regexp.MustCompile(sectionPattern)
+
+	sectionMatch := re.FindStringSubmatch(input)
+
+	if len(sectionMatch) < 2 {
+		return 0, fmt.Errorf("could not extract section")
+	}
+
+	section, err := strconv.Atoi(sectionMatch[1])
+	if err != nil {
+		return 0, fmt.Errorf("could not parse section: %v", err)
+	}
+
+	return section, nil
+}
+
+func extractRow(input string) (int, error) {
+	rowPattern := `Row (\d+)`
+	re := regexp.MustCompile(rowPattern)
+
+	rowMatch := re.FindStringSubmatch(input)
+
+	if len(rowMatch) < 2 {
+		return 0, fmt.Errorf("could not extract row")
+	}
+
+	row, err := strconv.Atoi(rowMatch[1])
+	if err != nil {
+		return 0, fmt.Errorf("could not parse row: %v", err)
+	}
+
+	return row, nil
+}
+
+func extractTicketInfo(input string) (*Ticket, error) {
+	price, err := extractPrice(input)
+	if err != nil {
+		return nil, err
+	}
+
+	section, err := extractSection(input)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := extractRow(input)
+	if err != nil {
+		return nil, err
+	}
+
+	id := generateID(price, row, section)
+
+	return &Ticket{
+		Price:   price,
+		Row:     strconv.Itoa(row),
+		Section: strconv.Itoa(section),
+		ID:      id,
+	}, nil
+}
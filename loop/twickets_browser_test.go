@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseTwicketsPage(t *testing.T) {
+	body, err := os.ReadFile("testdata/twickets-event.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "https://www.twickets.live/en/event/123"
+	tickets, err := parseTwicketsPage(context.Background(), body, "123", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Text split across inline elements reads as one line, and the
+	// standing listing without a section or row is dropped.
+	want := []Ticket{
+		{Source: "twickets-browser", EventID: "123", ID: generateID(94.5, 14, 112), Price: 94.5, Row: "14", Section: "112", Link: url},
+		{Source: "twickets-browser", EventID: "123", ID: generateID(120, 2, 305), Price: 120, Row: "2", Section: "305", Link: url},
+	}
+	if !reflect.DeepEqual(tickets, want) {
+		t.Errorf("got tickets\n%+v\nwant\n%+v", tickets, want)
+	}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	viagogoUrl = "https://www.viagogo.com/ww/Sports-Tickets/NFL/NFL-Matchups/Bears-vs-Jaguars/E-153572300?quantity=2&listingQty=&sections=&ticketClasses=&rows=&seats=&seatTypes="
+)
+
+type AppData struct {
+	AppName string `json:"appName"`
+	Grid    Grid   `json:"grid"`
+}
+
+type Grid struct {
+	Items       []Item `json:"items"`
+	TotalCount  int    `json:"totalCount"`
+	CurrentPage int    `json:"currentPage"`
+	PageSize    int    `json:"pageSize"`
+}
+
+// gridRequest is the body the event page posts to itself to load further
+// pages of the listing grid. The filters are the comma separated IDs from
+// the event URL's query.
+type gridRequest struct {
+	ShowAllTickets          bool   `json:"ShowAllTickets"`
+	HideDuplicateTicketsV2  bool   `json:"HideDuplicateTicketsV2"`
+	Quantity                int    `json:"Quantity"`
+	IsInitialQuantityChange bool   `json:"IsInitialQuantityChange"`
+	PageSize                int    `json:"PageSize"`
+	CurrentPage             int    `json:"CurrentPage"`
+	SortBy                  string `json:"SortBy"`
+	SortDirection           int    `json:"SortDirection"`
+	Sections                string `json:"Sections"`
+	TicketClasses           string `json:"TicketClasses"`
+	Rows                    string `json:"Rows"`
+	Seats                   string `json:"Seats"`
+	SeatTypes               string `json:"SeatTypes"`
+	ListingQuantity         string `json:"ListingQuantity"`
+}
+
+type Item struct {
+	ID                                  int64               `json:"id"`
+	ClientApplicationID                 int                 `json:"clientApplicationId"`
+	EventID                             int                 `json:"eventId"`
+	Section                             string              `json:"section"`
+	SectionID                           int                 `json:"sectionId"`
+	SectionMapName                      string              `json:"sectionMapName"`
+	SectionType                         int                 `json:"sectionType"`
+	Row                                 string              `json:"row"`
+	SeatFromInternal                    string              `json:"seatFromInternal"`
+	HasSeatDetails                      bool                `json:"hasSeatDetails"`
+	HasSeatDetailsUS                    bool                `json:"hasSeatDetailsUS"`
+	AvailableTickets                    int                 `json:"availableTickets"`
+	ListingPreviewPriceAndFeeDisclosure ValueDisclosure     `json:"listingPreviewPriceAndFeeDisclosure"`
+	SoldXTimeAgoSiteMessage             SoldMessage         `json:"soldXTimeAgoSiteMessage"`
+	ShowRecentlySold                    bool                `json:"showRecentlySold"`
+	AvailableQuantities                 []int               `json:"availableQuantities"`
+	TicketClass                         int                 `json:"ticketClass"`
+	TicketClassName                     string              `json:"ticketClassName"`
+	MaxQuantity                         int                 `json:"maxQuantity"`
+	HasListingNotes                     bool                `json:"hasListingNotes"`
+	ListingNotes                        []ListingNote       `json:"listingNotes"`
+	RowID                               int                 `json:"rowId"`
+	IsUsersListing                      bool                `json:"isUsersListing"`
+	IsPreUploaded                       bool                `json:"isPreUploaded"`
+	RowContent                          string              `json:"rowContent"`
+	RawPrice                            float64             `json:"rawPrice"`
+	Price                               string              `json:"price"`
+	TicketTypeID                        int                 `json:"ticketTypeId"`
+	TicketTypeGroupID                   int                 `json:"ticketTypeGroupId"`
+	ListingTypeID                       int                 `json:"listingTypeId"`
+	ListingCurrencyCode                 string              `json:"listingCurrencyCode"`
+	BuyerCurrencyCode                   string              `json:"buyerCurrencyCode"`
+	QualityRank                         int                 `json:"qualityRank"`
+	FaceValue                           float64             `json:"faceValue"`
+	FaceValueCurrencyCode               string              `json:"faceValueCurrencyCode"`
+	VfsURL                              string              `json:"vfsUrl"`
+	FormattedActiveSince                string              `json:"formattedActiveSince"`
+	IsSeatedTogether                    bool                `json:"isSeatedTogether"`
+	SellerUserID                        string              `json:"sellerUserId"`
+	ShowVfsInListing                    bool                `json:"showVfsInListing"`
+	HideSeatAndRowInfo                  bool                `json:"hideSeatAndRowInfo"`
+	SellerHideSeatInfo                  bool                `json:"sellerHideSeatInfo"`
+	AipHash                             string              `json:"aipHash"`
+	IsMLBVerified                       bool                `json:"isMLBVerified"`
+	IsStanding                          bool                `json:"isStanding"`
+	CreatedDateTime                     string              `json:"createdDateTime"`
+	IsHighestListingScore               bool                `json:"isHighestListingScore"`
+	IsMostAffordable                    bool                `json:"isMostAffordable"`
+	IsSponsored                         bool                `json:"isSponsored"`
+	IsCheapestListing                   bool                `json:"isCheapestListing"`
+	InventoryListingScore               *InventoryScore     `json:"inventoryListingScore,omitempty"`
+	TicketsRemainingMessage             *RemainingMessage   `json:"ticketsRemainingMessage,omitempty"`
+	BestSellingInSectionMessage         *BestSellingMessage `json:"bestSellingInSectionMessage,omitempty"`
+}
+
+type ValueDisclosure struct {
+	HasValue bool `json:"hasValue"`
+}
+
+type SoldMessage struct {
+	Message            string `json:"message"`
+	Qualifier          string `json:"qualifier"`
+	HasValue           bool   `json:"hasValue"`
+	FeatureTrackingKey string `json:"featureTrackingKey"`
+}
+
+type ListingNote struct {
+	ListingNoteID                   int    `json:"listingNoteId"`
+	ListingNoteContentID            int    `json:"listingNoteContentId"`
+	FormattedListingNoteContent     string `json:"formattedListingNoteContent"`
+	ListingNoteTypeID               int    `json:"listingNoteTypeId"`
+	ShowToBuyer                     bool   `json:"showToBuyer"`
+	HideInMock                      bool   `json:"hideInMock"`
+	SiteAddedListingNote            bool   `json:"siteAddedListingNote"`
+	AisleListingNoteWithSplit       bool   `json:"aisleListingNoteWithSplit"`
+	ListingNoteDescriptionContentID int    `json:"listingNoteDescriptionContentId"`
+	FormattedListingNoteDescription string `json:"formattedListingNoteDescription"`
+}
+
+type InventoryScore struct {
+	Discount         float64 `json:"discount"`
+	StarRating       float64 `json:"starRating"`
+	DealScore        float64 `json:"dealScore"`
+	SeatQualityScore float64 `json:"seatQualityScore"`
+}
+
+type RemainingMessage struct {
+	Message            string `json:"message"`
+	Qualifier          string `json:"qualifier"`
+	HasValue           bool   `json:"hasValue"`
+	FeatureTrackingKey string `json:"featureTrackingKey"`
+}
+
+type BestSellingMessage struct {
+	Message            string `json:"message"`
+	Qualifier          string `json:"qualifier"`
+	Disclaimer         string `json:"disclaimer"`
+	HasValue           bool   `json:"hasValue"`
+	FeatureTrackingKey string `json:"featureTrackingKey"`
+}
+
+const (
+	// Challenge pages are small, so this much of a page is enough to
+	// classify one when index-data is missing.
+	classifyPrefix = 64 << 10
+
+	viagogoMaxPages = 5
+)
+
+// viagogoSource polls a marketplace on the viagogo platform, which embeds
+// the first page of an event's listing grid in the event page as index-data.
+// StubHub runs on the same platform.
+type viagogoSource struct {
+	marketplace string
+	url         string
+	eventID     string
+	memo        fetchMemo
+}
+
+func (s *viagogoSource) Name() string {
+	return s.marketplace
+}
+
+func (s *viagogoSource) GetTickets(ctx context.Context) ([]Ticket, error) {
+	payload, v, err := getIndexData(ctx, s.marketplace, s.url, &s.memo)
+	if err != nil {
+		return nil, err
+	}
+
+	if tickets, ok := s.memo.reuse(s.Name(), payload); ok {
+		return tickets, nil
+	}
+
+	var appData AppData
+	if err := json.Unmarshal(payload, &appData); err != nil {
+		return nil, schemaChanged("could not parse index-data: %v", err)
+	}
+
+	items := appData.Grid.Items
+	paginated := appData.Grid.TotalCount > len(items)
+	if paginated {
+		items, err = s.gridPages(ctx, appData.Grid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var raw struct {
+		Grid struct {
+			Items []json.RawMessage `json:"items"`
+		} `json:"grid"`
+	}
+	json.Unmarshal(payload, &raw)
+	drift := compareFields[Item](raw.Grid.Items)
+
+	re := regexp.MustCompile("[^0-9]+")
+
+	tickets := []Ticket{}
+	for _, item := range items {
+		// Recently sold listings stay in the grid for a while. They're
+		// passed on as sales, but aren't validated like live ones.
+		sold := item.SoldXTimeAgoSiteMessage.HasValue || item.ShowRecentlySold
+
+		numericString := re.ReplaceAllString(item.Price, "")
+		price, err := strconv.Atoi(numericString)
+		if sold && (err != nil || price <= 0 || item.ID == 0 || item.Section == "") {
+			continue
+		}
+		if err != nil || price <= 0 {
+			listingsRejected.WithLabelValues(s.Name(), "price").Inc()
+			loggerFrom(ctx).Warn("Could not parse price", "listing", item.ID, "price", item.Price)
+			drift.Invalid["price"]++
+			continue
+		}
+
+		if item.ID == 0 || item.Section == "" {
+			field := "id"
+			if item.ID != 0 {
+				field = "section"
+			}
+			listingsRejected.WithLabelValues(s.Name(), field).Inc()
+			drift.Invalid[field]++
+			continue
+		}
+
+		ticket := Ticket{
+			Source:   s.Name(),
+			EventID:  strconv.Itoa(item.EventID),
+			ID:       strconv.FormatInt(item.ID, 10),
+			Price:    float64(price),
+			Row:      item.Row,
+			Section:  item.Section,
+			Quantity: item.AvailableTickets,
+			Link:     listingLink(s.url, item.ID),
+			Currency: item.BuyerCurrencyCode,
+		}
+
+		if item.IsSeatedTogether && !item.HideSeatAndRowInfo && !item.SellerHideSeatInfo {
+			ticket.Seats = seatRange(item.SeatFromInternal, item.AvailableTickets)
+		}
+
+		if item.InventoryListingScore != nil {
+			ticket.Score = item.InventoryListingScore.DealScore
+		}
+
+		if sold {
+			ticket.Sold = true
+			ticket.SoldAgo = parseSoldAgo(item.SoldXTimeAgoSiteMessage.Message)
+			tickets = append(tickets, ticket)
+			continue
+		}
+
+		listingsParsed.WithLabelValues(s.Name()).Inc()
+		tickets = append(tickets, ticket)
+	}
+
+	schemas.report(ctx, s.Name(), s.eventID, drift, payload)
+	if len(tickets) == 0 && len(drift.Invalid) > 0 {
+		return nil, schemaChanged("every listing failed validation: %s", drift)
+	}
+
+	// The page only vouches for its first page of listings, so a grid
+	// that spans several can't be reused from it next time.
+	if !paginated {
+		s.memo.store(v, payload, tickets)
+	}
+
+	return tickets, nil
+}
+
+// gridPages loads every page of a listing grid that spans more than the
+// first page embedded in the event page, using the filters in the event URL.
+// The embedded page keeps the site's default order, so page 1 is fetched
+// again sorted the same way as the rest, or listings would be skipped or
+// repeated where the pages meet.
+func (s *viagogoSource) gridPages(ctx context.Context, first Grid) ([]Item, error) {
+	filters, err := gridFilters(s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := first.PageSize
+	if pageSize <= 0 {
+		pageSize = len(first.Items)
+	}
+	filters.PageSize = pageSize
+
+	pages := (first.TotalCount + pageSize - 1) / pageSize
+	if pages > viagogoMaxPages {
+		loggerFrom(ctx).Warn("Listing grid truncated", "total", first.TotalCount, "pages", pages, "max", viagogoMaxPages)
+		pages = viagogoMaxPages
+	}
+
+	grids := make([][]Item, 0, pages)
+	for page := 1; page <= pages; page++ {
+		filters.CurrentPage = page
+		grid, err := getGridPage(ctx, s.marketplace, s.url, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(grid.Items) == 0 {
+			break
+		}
+		grids = append(grids, grid.Items)
+	}
+
+	return mergeGridPages(grids), nil
+}
+
+// mergeGridPages joins the pages of a grid in order. A listing that moved
+// onto a later page between requests is only kept the first time.
+func mergeGridPages(pages [][]Item) []Item {
+	items := make([]Item, 0)
+	seen := make(map[int64]bool)
+	for _, page := range pages {
+		for _, item := range page {
+			if !seen[item.ID] {
+				seen[item.ID] = true
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
+
+// listingLink deep links to a listing by adding its ID to the event URL, so
+// the quantity and filters the watch uses are kept.
+func listingLink(eventUrl string, listingID int64) string {
+	separator := "&"
+	if !strings.Contains(eventUrl, "?") {
+		separator = "?"
+	}
+
+	return fmt.Sprintf("%s%slistingId=%d", eventUrl, separator, listingID)
+}
+
+// gridFilters reads the quantity and server side filters from an event URL.
+func gridFilters(eventUrl string) (gridRequest, error) {
+	u, err := url.Parse(eventUrl)
+	if err != nil {
+		return gridRequest{}, err
+	}
+	query := u.Query()
+
+	quantity := 0
+	if value := query.Get("quantity"); value != "" {
+		quantity, err = strconv.Atoi(value)
+		if err != nil {
+			return gridRequest{}, fmt.Errorf("invalid quantity %q in %s", value, eventUrl)
+		}
+	}
+
+	return gridRequest{
+		ShowAllTickets:  true,
+		Quantity:        quantity,
+		SortBy:          "NEWPRICE",
+		Sections:        query.Get("sections"),
+		TicketClasses:   query.Get("ticketClasses"),
+		Rows:            query.Get("rows"),
+		Seats:           query.Get("seats"),
+		SeatTypes:       query.Get("seatTypes"),
+		ListingQuantity: query.Get("listingQty"),
+	}, nil
+}
+
+func getGridPage(ctx context.Context, marketplace, eventUrl string, filters gridRequest) (*Grid, error) {
+	body, err := json.Marshal(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newRequest(ctx, marketplace, "POST", eventUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	response, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	observeHttpResponse(marketplace, response.StatusCode)
+
+	page, err := io.ReadAll(&countingReader{source: marketplace, r: response.Body})
+	if err != nil {
+		return nil, err
+	}
+	capturePage(ctx, marketplace, "json", page)
+	archiveResponse(ctx, marketplace, response, page)
+
+	if fetchErr := classifyResponse(response, page, "items"); fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	var grid Grid
+	if err := json.Unmarshal(page, &grid); err != nil {
+		return nil, schemaChanged("could not parse grid page %d: %v", filters.CurrentPage, err)
+	}
+
+	return &grid, nil
+}
+
+// getIndexData fetches an event page and returns the contents of its
+// index-data script. The page is tokenized as it arrives and the rest of it
+// is never downloaded. A nil payload means the page hasn't changed since
+// memo last stored one.
+func getIndexData(ctx context.Context, marketplace, url string, memo *fetchMemo) ([]byte, validators, error) {
+	req, err := newRequest(ctx, marketplace, "GET", url, nil)
+	if err != nil {
+		return nil, validators{}, err
+	}
+	memo.prepare(req)
+
+	response, err := doRequest(req)
+	if err != nil {
+		return nil, validators{}, err
+	}
+	defer response.Body.Close()
+
+	observeHttpResponse(marketplace, response.StatusCode)
+
+	if response.StatusCode == http.StatusNotModified {
+		archiveResponse(ctx, marketplace, response, nil)
+		return nil, validators{}, nil
+	}
+
+	body := io.Reader(&countingReader{source: marketplace, r: response.Body})
+
+	if response.StatusCode != http.StatusOK {
+		page, err := io.ReadAll(body)
+		if err != nil {
+			return nil, validators{}, err
+		}
+		capturePage(ctx, marketplace, "html", page)
+		archiveResponse(ctx, marketplace, response, page)
+
+		return nil, validators{}, classifyResponse(response, page, "index-data")
+	}
+
+	// The archive gets the page up to where we stopped reading, which is
+	// enough to replay it. Debug captures get all of it.
+	prefix := &prefixBuffer{limit: classifyPrefix}
+	var read bytes.Buffer
+	if captureDir != "" || archiveDir != "" {
+		body = io.TeeReader(body, io.MultiWriter(prefix, &read))
+	} else {
+		body = io.TeeReader(body, prefix)
+	}
+
+	payload, err := findScript(body, "index-data")
+	archiveResponse(ctx, marketplace, response, read.Bytes())
+	if captureDir != "" {
+		io.Copy(&read, response.Body)
+		capturePage(ctx, marketplace, "html", read.Bytes())
+	}
+	if err != nil {
+		return nil, validators{}, err
+	}
+
+	if payload == nil {
+		if fetchErr := classifyResponse(response, prefix.buf, "index-data"); fetchErr != nil {
+			return nil, validators{}, fetchErr
+		}
+		return nil, validators{}, schemaChanged("script#index-data not found")
+	}
+
+	return payload, validatorsOf(response), nil
+}
+
+// findScript reads HTML from r up to the end of the script element with the
+// given id and returns its contents, or nil if the document has none.
+func findScript(r io.Reader, id string) ([]byte, error) {
+	tokenizer := html.NewTokenizer(r)
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return nil, nil
+			}
+			return nil, tokenizer.Err()
+		case html.StartTagToken:
+			name, hasAttr := tokenizer.TagName()
+			if string(name) != "script" || !hasAttr {
+				continue
+			}
+
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				if string(key) != "id" || string(value) != id {
+					continue
+				}
+
+				if tokenizer.Next() != html.TextToken {
+					return []byte{}, nil
+				}
+				return bytes.Clone(tokenizer.Text()), nil
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func itemIDs(items []Item) []int64 {
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func TestMergeGridPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages [][]Item
+		want  []int64
+	}{
+		{"no pages", nil, []int64{}},
+		{"one page", [][]Item{{{ID: 1}, {ID: 2}}}, []int64{1, 2}},
+		{"pages in order", [][]Item{{{ID: 1}, {ID: 2}}, {{ID: 3}, {ID: 4}}}, []int64{1, 2, 3, 4}},
+		{"listing pushed onto the next page", [][]Item{{{ID: 1}, {ID: 2}}, {{ID: 2}, {ID: 3}}}, []int64{1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := itemIDs(mergeGridPages(test.pages))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestGridPages checks every page, the first included, is requested with
+// the watch's filters and the same sort, and the pages are merged in order.
+func TestGridPages(t *testing.T) {
+	pages := map[int][]Item{
+		1: {{ID: 10}, {ID: 11}},
+		2: {{ID: 11}, {ID: 12}},
+		3: {{ID: 13}},
+	}
+
+	requested := make([]int, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var filters gridRequest
+		if err := json.NewDecoder(r.Body).Decode(&filters); err != nil {
+			t.Errorf("decoding grid request: %v", err)
+		}
+		if r.Method != "POST" || filters.SortBy != "NEWPRICE" || filters.Quantity != 2 || filters.Sections != "1,2" || filters.PageSize != 2 {
+			t.Errorf("unexpected %s request %+v", r.Method, filters)
+		}
+		requested = append(requested, filters.CurrentPage)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Grid{Items: pages[filters.CurrentPage], TotalCount: 5, CurrentPage: filters.CurrentPage, PageSize: 2})
+	}))
+	defer server.Close()
+
+	s := &viagogoSource{marketplace: "viagogo", url: server.URL + "/E-1?quantity=2&sections=1,2"}
+	// The embedded page is in a different order to the sorted grid.
+	first := Grid{Items: []Item{{ID: 12}, {ID: 10}}, TotalCount: 5, CurrentPage: 1, PageSize: 2}
+
+	items, err := s.gridPages(context.Background(), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{1, 2, 3}; !slices.Equal(requested, want) {
+		t.Errorf("requested pages %v, want %v", requested, want)
+	}
+	if got, want := itemIDs(items), []int64{10, 11, 12, 13}; !slices.Equal(got, want) {
+		t.Errorf("got listings %v, want %v", got, want)
+	}
+}
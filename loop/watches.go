@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type watch struct {
+	ID      string `json:"id"`
+	Source  string `json:"source"`
+	EventID string `json:"eventId"`
+	URL     string `json:"url,omitempty"`
+	// Fixture names the game, so watches of it on different marketplaces
+	// are compared with each other. Left empty, it is matched from the
+	// title, venue and kickoff, see fixtureRegistry.link.
+	Fixture  string     `json:"fixture,omitempty"`
+	Title    string     `json:"title,omitempty"`
+	Venue    string     `json:"venue,omitempty"`
+	Kickoff  *time.Time `json:"kickoff,omitempty"`
+	MaxPrice float64    `json:"maxPrice"`
+	// Rules are market-relative thresholds checked on top of MaxPrice.
+	Rules        []ThresholdRule `json:"rules,omitempty"`
+	PhoneNumbers []string        `json:"phoneNumbers"`
+
+	source Source
+}
+
+type watchRegistry struct {
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+var (
+	registry = &watchRegistry{
+		watches: make(map[string]*watch),
+	}
+
+	presetWatches = map[string]watch{
+		"viagogo": {
+			Source:       "viagogo",
+			URL:          viagogoUrl,
+			Fixture:      "bears-jaguars",
+			MaxPrice:     100,
+			PhoneNumbers: []string{ethanPhoneNumber},
+		},
+		"twickets": {
+			Source:       "twickets",
+			EventID:      twicketsEventID,
+			Fixture:      "bears-jaguars",
+			MaxPrice:     115.0,
+			PhoneNumbers: []string{ethanPhoneNumber, dadPhoneNumber},
+		},
+		"twickets-browser": {
+			Source:       "twickets-browser",
+			EventID:      twicketsEventID,
+			Fixture:      "bears-jaguars",
+			MaxPrice:     150,
+			PhoneNumbers: []string{ethanPhoneNumber},
+		},
+	}
+)
+
+// presetNames lists the watches -sources can start with.
+func presetNames() []string {
+	names := make([]string, 0, len(presetWatches))
+	for name := range presetWatches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func extractViagogoEventID(url string) (string, error) {
+	re := regexp.MustCompile(`/E-(\d+)`)
+
+	match := re.FindStringSubmatch(url)
+	if len(match) < 2 {
+		return "", fmt.Errorf("could not extract event ID from %s", url)
+	}
+
+	return match[1], nil
+}
+
+// newWatch fills in the ID and source of a watch described by its source
+// name, event ID and, for viagogo and StubHub, event URL.
+func newWatch(w watch) (*watch, error) {
+	switch w.Source {
+	case "viagogo":
+		if w.URL == "" {
+			return nil, fmt.Errorf("viagogo watches need a url")
+		}
+
+		eventID, err := extractViagogoEventID(w.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		w.EventID = eventID
+		w.source = &viagogoSource{marketplace: "viagogo", url: w.URL, eventID: eventID}
+		if w.Title == "" {
+			w.Title = titleFromUrl(w.URL, "E-")
+		}
+	case "stubhub":
+		// StubHub watches can be given either the event page or its ID.
+		if w.URL == "" && w.EventID != "" {
+			w.URL = fmt.Sprintf(stubhubEventUrl, w.EventID)
+		}
+
+		eventID, err := extractStubhubEventID(w.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		w.EventID = eventID
+		w.source = newStubhubSource(w.URL, eventID)
+		if w.Title == "" {
+			w.Title = titleFromUrl(w.URL, "event")
+		}
+	case "twickets":
+		w.source = newFallbackSource(w.Source, w.EventID,
+			&twicketsSource{eventID: w.EventID, split: twicketsSplit},
+			&twicketsBrowserSource{eventID: w.EventID})
+	case "twickets-api":
+		w.source = &twicketsSource{eventID: w.EventID, split: twicketsSplit}
+	case "twickets-browser":
+		w.source = &twicketsBrowserSource{eventID: w.EventID}
+	case "ticketmaster":
+		w.source = &ticketmasterSource{eventID: w.EventID, quantity: ticketmasterQuantity}
+	case "seatgeek":
+		w.source = &seatgeekSource{eventID: w.EventID, quantity: seatgeekQuantity}
+	case "axs":
+		w.source = &axsSource{eventID: w.EventID, quantity: axsQuantity}
+	default:
+		return nil, fmt.Errorf("unknown source %q", w.Source)
+	}
+
+	if w.EventID == "" {
+		return nil, fmt.Errorf("%s watches need an eventId", w.Source)
+	}
+
+	if w.MaxPrice <= 0 {
+		return nil, fmt.Errorf("maxPrice must be positive")
+	}
+
+	for _, rule := range w.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	w.Rules = slices.Clone(w.Rules)
+
+	w.ID = w.Source + "-" + w.EventID
+	w.PhoneNumbers = slices.Clone(w.PhoneNumbers)
+	if w.PhoneNumbers == nil {
+		w.PhoneNumbers = []string{}
+	}
+
+	return &w, nil
+}
+
+func (r *watchRegistry) add(w *watch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.watches[w.ID]; ok {
+		return fmt.Errorf("already watching %s", w.ID)
+	}
+
+	r.watches[w.ID] = w
+	return nil
+}
+
+func (r *watchRegistry) remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.watches[id]; !ok {
+		return false
+	}
+
+	delete(r.watches, id)
+	return true
+}
+
+// update applies fn to the watch with the given ID and returns a copy of the
+// result. Polls in flight keep the copy they started with.
+func (r *watchRegistry) update(id string, fn func(w *watch) error) (watch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.watches[id]
+	if !ok {
+		return watch{}, errWatchNotFound
+	}
+
+	updated := *w
+	updated.PhoneNumbers = slices.Clone(w.PhoneNumbers)
+	if err := fn(&updated); err != nil {
+		return watch{}, err
+	}
+
+	r.watches[id] = &updated
+	return updated, nil
+}
+
+func (r *watchRegistry) get(id string) (watch, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.watches[id]
+	if !ok {
+		return watch{}, false
+	}
+
+	return *w, true
+}
+
+func (r *watchRegistry) list() []watch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	watches := make([]watch, 0, len(r.watches))
+	for _, w := range r.watches {
+		watches = append(watches, *w)
+	}
+
+	sort.Slice(watches, func(i, j int) bool {
+		return watches[i].ID < watches[j].ID
+	})
+
+	return watches
+}
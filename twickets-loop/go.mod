@@ -1,15 +0,0 @@
-module github.com/ethanhosier/twickets-loop
-
-go 1.23.2
-
-require github.com/go-rod/rod v0.116.2
-
-require (
-	github.com/go-rod/stealth v0.4.9 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/ysmood/fetchup v0.2.3 // indirect
-	github.com/ysmood/goob v0.4.0 // indirect
-	github.com/ysmood/got v0.40.0 // indirect
-	github.com/ysmood/gson v0.7.3 // indirect
-	github.com/ysmood/leakless v0.9.0 // indirect
-)